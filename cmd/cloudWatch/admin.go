@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// retentionDays are the values PutRetentionPolicy accepts.
+var retentionDays = []int32{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// ListLogGroups returns all log groups whose name starts with prefix.
+func ListLogGroups(ctx context.Context, svc *cloudwatchlogs.Client, prefix string) ([]types.LogGroup, error) {
+	input := &cloudwatchlogs.DescribeLogGroupsInput{}
+	if prefix != "" {
+		input.LogGroupNamePrefix = aws.String(prefix)
+	}
+	var groups []types.LogGroup
+	paginator := cloudwatchlogs.NewDescribeLogGroupsPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe log groups: %w", err)
+		}
+		groups = append(groups, page.LogGroups...)
+	}
+	return groups, nil
+}
+
+// ListLogStreams returns the streams of a group whose name starts with prefix. Without a prefix
+// they are ordered by last event time, most recent first; the API cannot combine both.
+func ListLogStreams(ctx context.Context, svc *cloudwatchlogs.Client, group, prefix string) ([]types.LogStream, error) {
+	input := &cloudwatchlogs.DescribeLogStreamsInput{LogGroupName: aws.String(group)}
+	if prefix != "" {
+		input.LogStreamNamePrefix = aws.String(prefix)
+	} else {
+		input.OrderBy = types.OrderByLastEventTime
+		input.Descending = aws.Bool(true)
+	}
+	var streams []types.LogStream
+	paginator := cloudwatchlogs.NewDescribeLogStreamsPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe log streams of %s: %w", group, err)
+		}
+		streams = append(streams, page.LogStreams...)
+	}
+	return streams, nil
+}
+
+// SetRetention sets the retention of a group in days, 0 removes the policy so events never
+// expire.
+func SetRetention(ctx context.Context, svc *cloudwatchlogs.Client, group string, days int32) error {
+	if days == 0 {
+		_, err := svc.DeleteRetentionPolicy(ctx, &cloudwatchlogs.DeleteRetentionPolicyInput{LogGroupName: aws.String(group)})
+		return err
+	}
+	if !slices.Contains(retentionDays, days) {
+		return fmt.Errorf("retention of %d days is not supported, use one of %v", days, retentionDays)
+	}
+	_, err := svc.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    aws.String(group),
+		RetentionInDays: aws.Int32(days),
+	})
+	return err
+}
+
+// DeleteLogGroup deletes a group with all its streams.
+func DeleteLogGroup(ctx context.Context, svc *cloudwatchlogs.Client, group string) error {
+	_, err := svc.DeleteLogGroup(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: aws.String(group)})
+	if err != nil {
+		return fmt.Errorf("delete log group %s: %w", group, err)
+	}
+	return nil
+}
+
+// DeleteLogStream deletes a stream and its events.
+func DeleteLogStream(ctx context.Context, svc *cloudwatchlogs.Client, group, stream string) error {
+	_, err := svc.DeleteLogStream(ctx, &cloudwatchlogs.DeleteLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+	if err != nil {
+		return fmt.Errorf("delete log stream %s/%s: %w", group, stream, err)
+	}
+	return nil
+}
+
+// LogGroupArn returns the ARN of a group as the tagging API expects it, without the ":*" suffix.
+func LogGroupArn(ctx context.Context, svc *cloudwatchlogs.Client, group string) (string, error) {
+	groups, err := ListLogGroups(ctx, svc, group)
+	if err != nil {
+		return "", err
+	}
+	for _, g := range groups {
+		if aws.ToString(g.LogGroupName) != group {
+			continue
+		}
+		if arn := aws.ToString(g.LogGroupArn); arn != "" {
+			return arn, nil
+		}
+		return strings.TrimSuffix(aws.ToString(g.Arn), ":*"), nil
+	}
+	return "", fmt.Errorf("log group %s not found", group)
+}
+
+// TagLogGroup adds or replaces tags of a group.
+func TagLogGroup(ctx context.Context, svc *cloudwatchlogs.Client, group string, tags map[string]string) error {
+	arn, err := LogGroupArn(ctx, svc, group)
+	if err != nil {
+		return err
+	}
+	_, err = svc.TagResource(ctx, &cloudwatchlogs.TagResourceInput{ResourceArn: aws.String(arn), Tags: tags})
+	return err
+}
+
+// UntagLogGroup removes tags of a group.
+func UntagLogGroup(ctx context.Context, svc *cloudwatchlogs.Client, group string, keys []string) error {
+	arn, err := LogGroupArn(ctx, svc, group)
+	if err != nil {
+		return err
+	}
+	_, err = svc.UntagResource(ctx, &cloudwatchlogs.UntagResourceInput{ResourceArn: aws.String(arn), TagKeys: keys})
+	return err
+}
+
+// LogGroupTags returns the tags of a group.
+func LogGroupTags(ctx context.Context, svc *cloudwatchlogs.Client, group string) (map[string]string, error) {
+	arn, err := LogGroupArn(ctx, svc, group)
+	if err != nil {
+		return nil, err
+	}
+	out, err := svc.ListTagsForResource(ctx, &cloudwatchlogs.ListTagsForResourceInput{ResourceArn: aws.String(arn)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Tags, nil
+}
+
+// parseTags parses "key=value,key2=value2".
+func parseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("tag %q is not key=value", pair)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func formatMillis(ms *int64) string {
+	if ms == nil {
+		return "-"
+	}
+	return time.UnixMilli(*ms).UTC().Format(time.DateTime)
+}
+
+// GroupCommand handles `group list|streams|retention|delete|delete-stream|tag|untag|tags`.
+//
+//	group list -prefix my-
+//	group streams -group my-log-group [-prefix my-]
+//	group retention -group my-log-group -days 7
+//	group delete -group my-log-group
+//	group delete -prefix test- -yes
+//	group delete-stream -group my-log-group -stream my-log-stream
+//	group tag -group my-log-group -tags env=dev,team=core
+//	group untag -group my-log-group -tags env
+//	group tags -group my-log-group
+func GroupCommand(svc *cloudwatchlogs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: group list|streams|retention|delete|delete-stream|tag|untag|tags [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("group "+action, flag.ExitOnError)
+	group := fs.String("group", "", "log group name")
+	stream := fs.String("stream", "", "log stream name (delete-stream only)")
+	prefix := fs.String("prefix", "", "group name prefix, stream name prefix for streams")
+	days := fs.Int("days", 0, "retention in days, 0 to keep events forever (retention only)")
+	tags := fs.String("tags", "", "key=value pairs to tag, keys to untag, comma separated")
+	yes := fs.Bool("yes", false, "delete every group matching -prefix")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	needGroup := func() error {
+		if *group == "" {
+			return fmt.Errorf("group %s needs -group", action)
+		}
+		return nil
+	}
+
+	switch action {
+	case "list":
+		groups, err := ListLogGroups(ctx, svc, *prefix)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tRETENTION\tSTORED BYTES\tCREATED")
+		for _, g := range groups {
+			retention := "never expire"
+			if g.RetentionInDays != nil {
+				retention = fmt.Sprintf("%d days", *g.RetentionInDays)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", aws.ToString(g.LogGroupName), retention, aws.ToInt64(g.StoredBytes), formatMillis(g.CreationTime))
+		}
+		return w.Flush()
+	case "streams":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		streams, err := ListLogStreams(ctx, svc, *group, *prefix)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STREAM\tFIRST EVENT\tLAST EVENT\tCREATED")
+		for _, s := range streams {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", aws.ToString(s.LogStreamName), formatMillis(s.FirstEventTimestamp), formatMillis(s.LastEventTimestamp), formatMillis(s.CreationTime))
+		}
+		return w.Flush()
+	case "retention":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		if err := SetRetention(ctx, svc, *group, int32(*days)); err != nil {
+			return err
+		}
+		log.Printf("Set retention of %s to %d days\n", *group, *days)
+		return nil
+	case "delete":
+		if *group != "" {
+			if err := DeleteLogGroup(ctx, svc, *group); err != nil {
+				return err
+			}
+			log.Printf("Deleted %s\n", *group)
+			return nil
+		}
+		if *prefix == "" {
+			return errors.New("group delete needs -group or -prefix")
+		}
+		groups, err := ListLogGroups(ctx, svc, *prefix)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if !*yes {
+				log.Printf("Would delete %s, add -yes to delete\n", aws.ToString(g.LogGroupName))
+				continue
+			}
+			if err := DeleteLogGroup(ctx, svc, aws.ToString(g.LogGroupName)); err != nil {
+				return err
+			}
+			log.Printf("Deleted %s\n", aws.ToString(g.LogGroupName))
+		}
+		return nil
+	case "delete-stream":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		if err := DeleteLogStream(ctx, svc, *group, *stream); err != nil {
+			return err
+		}
+		log.Printf("Deleted %s/%s\n", *group, *stream)
+		return nil
+	case "tag":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		t, err := parseTags(*tags)
+		if err != nil {
+			return err
+		}
+		return TagLogGroup(ctx, svc, *group, t)
+	case "untag":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		return UntagLogGroup(ctx, svc, *group, strings.Split(*tags, ","))
+	case "tags":
+		if err := needGroup(); err != nil {
+			return err
+		}
+		t, err := LogGroupTags(ctx, svc, *group)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			log.Printf("  %s: %s\n", k, t[k])
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown group action %q", action)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Export file formats
+const (
+	FormatJSONLines = "jsonl"
+	FormatText      = "text"
+)
+
+// ReadStream calls fn for every event of a stream between start and end, zero values being open
+// ends, oldest first. GetLogEvents keeps returning the same forward token once the end of the
+// stream is reached, even from empty pages in between, so a repeated token ends the read.
+func ReadStream(ctx context.Context, svc *cloudwatchlogs.Client, group, stream string, start, end time.Time, fn func(types.OutputLogEvent) error) error {
+	input := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+		StartFromHead: aws.Bool(true),
+	}
+	if !start.IsZero() {
+		input.StartTime = aws.Int64(start.UnixMilli())
+	}
+	if !end.IsZero() {
+		input.EndTime = aws.Int64(end.UnixMilli())
+	}
+
+	for {
+		out, err := svc.GetLogEvents(ctx, input)
+		if err != nil {
+			return fmt.Errorf("get log events of %s/%s: %w", group, stream, err)
+		}
+		for _, event := range out.Events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+		next := aws.ToString(out.NextForwardToken)
+		if next == "" || next == aws.ToString(input.NextToken) {
+			return nil
+		}
+		input.NextToken = aws.String(next)
+	}
+}
+
+// ExportRecord is a line of a JSON Lines export.
+type ExportRecord struct {
+	Timestamp     time.Time `json:"timestamp"`
+	IngestionTime time.Time `json:"ingestionTime"`
+	Message       string    `json:"message"`
+}
+
+// ExportOptions selects what ExportLogs writes and where.
+type ExportOptions struct {
+	Group string
+	// Stream limits the export to the stream with exactly this name
+	Stream string
+	// StreamPrefix limits the export to streams with this prefix
+	StreamPrefix string
+	Start        time.Time
+	End          time.Time
+	Dir          string
+	// Format is FormatJSONLines or FormatText
+	Format string
+	Gzip   bool
+}
+
+// ExportLogs writes the events of every stream of the group to a file per stream in Dir.
+// Streams without events in the time range get no file. It returns the files written.
+func ExportLogs(ctx context.Context, svc *cloudwatchlogs.Client, opts ExportOptions) ([]string, error) {
+	if opts.Format != FormatJSONLines && opts.Format != FormatText {
+		return nil, fmt.Errorf("unknown format %q, use jsonl or text", opts.Format)
+	}
+	if opts.Stream != "" && opts.StreamPrefix != "" {
+		return nil, errors.New("export either one stream or the streams with a prefix, not both")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	prefix := opts.StreamPrefix
+	if opts.Stream != "" {
+		prefix = opts.Stream
+	}
+	streams, err := ListLogStreams(ctx, svc, opts.Group, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Stream != "" {
+		streams = slices.DeleteFunc(streams, func(s types.LogStream) bool {
+			return aws.ToString(s.LogStreamName) != opts.Stream
+		})
+		if len(streams) == 0 {
+			return nil, fmt.Errorf("log stream %s/%s not found", opts.Group, opts.Stream)
+		}
+	}
+
+	names := make([]string, len(streams))
+	for i, s := range streams {
+		names[i] = aws.ToString(s.LogStreamName)
+	}
+	fileNames := exportFileNames(names, opts.Format, opts.Gzip)
+
+	var files []string
+	for _, s := range streams {
+		// Skip streams that have no events in the range
+		if !opts.Start.IsZero() && s.LastEventTimestamp != nil && *s.LastEventTimestamp < opts.Start.UnixMilli() {
+			continue
+		}
+		if !opts.End.IsZero() && s.FirstEventTimestamp != nil && *s.FirstEventTimestamp > opts.End.UnixMilli() {
+			continue
+		}
+
+		name := aws.ToString(s.LogStreamName)
+		path := filepath.Join(opts.Dir, fileNames[name])
+		n, err := exportStream(ctx, svc, opts, name, path)
+		if err != nil {
+			return files, err
+		}
+		if n > 0 {
+			files = append(files, path)
+			log.Printf("Exported %d events of %s to %s\n", n, name, path)
+		}
+	}
+	return files, nil
+}
+
+// exportStream writes one stream, creating the file on the first event.
+func exportStream(ctx context.Context, svc *cloudwatchlogs.Client, opts ExportOptions, stream, path string) (n int, err error) {
+	var (
+		f  *os.File
+		gz *gzip.Writer
+		w  *bufio.Writer
+	)
+	defer func() {
+		if f == nil {
+			return
+		}
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		if gz != nil {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	err = ReadStream(ctx, svc, opts.Group, stream, opts.Start, opts.End, func(event types.OutputLogEvent) error {
+		if f == nil {
+			var err error
+			if f, err = os.Create(path); err != nil {
+				return err
+			}
+			var out io.Writer = f
+			if opts.Gzip {
+				gz = gzip.NewWriter(f)
+				gz.Name = strings.TrimSuffix(filepath.Base(path), ".gz")
+				out = gz
+			}
+			w = bufio.NewWriter(out)
+		}
+		n++
+		return writeEvent(w, event, opts.Format)
+	})
+	return n, err
+}
+
+func writeEvent(w io.Writer, event types.OutputLogEvent, format string) error {
+	ts := time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC()
+	msg := strings.TrimRight(aws.ToString(event.Message), "\n")
+	if format == FormatText {
+		_, err := fmt.Fprintf(w, "%s %s\n", ts.Format("2006-01-02T15:04:05.000Z"), msg)
+		return err
+	}
+	line, err := json.Marshal(ExportRecord{
+		Timestamp:     ts,
+		IngestionTime: time.UnixMilli(aws.ToInt64(event.IngestionTime)).UTC(),
+		Message:       msg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// exportFileName maps a stream name, which may contain slashes and brackets such as
+// "2024/01/01/[$LATEST]abc", to a file name. Different streams can map to the same name, such
+// as "a/b" and "a_b"; exportFileNames resolves that.
+func exportFileName(stream, format string, gz bool) string {
+	return sanitizeStreamName(stream) + exportExtension(format, gz)
+}
+
+// exportFileNames returns the file name of every stream. When several streams map to the same
+// name, each of them whose name had to be changed gets a hash of its name appended, so the
+// result does not depend on the order of the streams.
+func exportFileNames(streams []string, format string, gz bool) map[string]string {
+	count := map[string]int{}
+	for _, stream := range streams {
+		count[sanitizeStreamName(stream)]++
+	}
+	names := make(map[string]string, len(streams))
+	for _, stream := range streams {
+		base := sanitizeStreamName(stream)
+		if count[base] == 1 || base == stream {
+			names[stream] = exportFileName(stream, format, gz)
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(stream))
+		names[stream] = fmt.Sprintf("%s-%08x%s", base, h.Sum32(), exportExtension(format, gz))
+	}
+	return names
+}
+
+func sanitizeStreamName(stream string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, stream)
+}
+
+func exportExtension(format string, gz bool) string {
+	ext := "." + format
+	if format == FormatText {
+		ext = ".log"
+	}
+	if gz {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// ExportCommand handles `export -group my-log-group -since 1h -dir logs -format jsonl -gzip`,
+// and `export -group my-log-group -stream my-log-stream` for a single stream.
+func ExportCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	stream := fs.String("stream", "", "only export the stream with this exact name")
+	prefix := fs.String("stream-prefix", "", "only export streams with this prefix")
+	since := fs.String("since", "", "start, as a duration before now or a time, all events if empty")
+	until := fs.String("until", "", "end, as a duration before now or a time")
+	dir := fs.String("dir", "logs", "output directory")
+	format := fs.String("format", FormatJSONLines, "file format: jsonl or text")
+	gz := fs.Bool("gzip", false, "gzip the files")
+	fs.Parse(args)
+
+	now := time.Now()
+	opts := ExportOptions{Group: *group, Stream: *stream, StreamPrefix: *prefix, Dir: *dir, Format: *format, Gzip: *gz}
+	var err error
+	if opts.Start, err = ParseTime(*since, now); err != nil {
+		return err
+	}
+	if opts.End, err = ParseTime(*until, now); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	files, err := ExportLogs(ctx, svc, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %d files to %s\n", len(files), *dir)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+)
+
+func TestExportFileName(t *testing.T) {
+	tests := []struct {
+		stream string
+		format string
+		gz     bool
+		want   string
+	}{
+		{"my-log-stream", FormatJSONLines, false, "my-log-stream.jsonl"},
+		{"my-log-stream", FormatText, false, "my-log-stream.log"},
+		{"my-log-stream", FormatJSONLines, true, "my-log-stream.jsonl.gz"},
+		{"my-log-stream", FormatText, true, "my-log-stream.log.gz"},
+		{"2024/01/01/[$LATEST]abc", FormatJSONLines, false, "2024_01_01___LATEST_abc.jsonl"},
+		{"app.v1_x", FormatJSONLines, false, "app.v1_x.jsonl"},
+		{"héllo wörld", FormatText, false, "h_llo_w_rld.log"},
+		{"../etc/passwd", FormatText, false, ".._etc_passwd.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stream, func(t *testing.T) {
+			if got := exportFileName(tt.stream, tt.format, tt.gz); got != tt.want {
+				t.Errorf("exportFileName(%q, %q, %t) = %q, want %q", tt.stream, tt.format, tt.gz, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportFileNames(t *testing.T) {
+	hash := func(s string) string {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		return fmt.Sprintf("%08x", h.Sum32())
+	}
+
+	tests := []struct {
+		name    string
+		streams []string
+		want    map[string]string
+	}{
+		{
+			name:    "no collision",
+			streams: []string{"a/b", "c"},
+			want:    map[string]string{"a/b": "a_b.jsonl", "c": "c.jsonl"},
+		},
+		{
+			name:    "changed name collides with unchanged name",
+			streams: []string{"a/b", "a_b"},
+			want:    map[string]string{"a/b": "a_b-" + hash("a/b") + ".jsonl", "a_b": "a_b.jsonl"},
+		},
+		{
+			name:    "order does not matter",
+			streams: []string{"a_b", "a/b"},
+			want:    map[string]string{"a/b": "a_b-" + hash("a/b") + ".jsonl", "a_b": "a_b.jsonl"},
+		},
+		{
+			name:    "changed names collide",
+			streams: []string{"a/b", "a:b", "a[b"},
+			want: map[string]string{
+				"a/b": "a_b-" + hash("a/b") + ".jsonl",
+				"a:b": "a_b-" + hash("a:b") + ".jsonl",
+				"a[b": "a_b-" + hash("a[b") + ".jsonl",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exportFileNames(tt.streams, FormatJSONLines, false)
+			if len(got) != len(tt.want) {
+				t.Fatalf("exportFileNames(%q) = %v, want %v", tt.streams, got, tt.want)
+			}
+			files := map[string]bool{}
+			for stream, want := range tt.want {
+				if got[stream] != want {
+					t.Errorf("file of %q = %q, want %q", stream, got[stream], want)
+				}
+				if files[got[stream]] {
+					t.Errorf("file %q is used twice", got[stream])
+				}
+				files[got[stream]] = true
+			}
+		})
+	}
+}
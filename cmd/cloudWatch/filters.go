@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"gopkg.in/yaml.v3"
+)
+
+// MetricFilterSpec describes a metric filter and the metric it publishes.
+type MetricFilterSpec struct {
+	Name       string `yaml:"name"`
+	Group      string `yaml:"group"`
+	Pattern    string `yaml:"pattern"`
+	MetricName string `yaml:"metric"`
+	Namespace  string `yaml:"namespace"`
+	// Value is published for every match, a number or a field such as $.latency, default 1
+	Value string `yaml:"value"`
+	// DefaultValue is published for periods without a match, none when nil
+	DefaultValue *float64 `yaml:"defaultValue"`
+	Unit         string   `yaml:"unit"`
+	// Samples are messages the pattern is tested against by CheckFilters
+	Samples []FilterSample `yaml:"samples"`
+}
+
+// FilterSample is a test message and whether the pattern must match it.
+type FilterSample struct {
+	Message string `yaml:"message"`
+	Match   bool   `yaml:"match"`
+}
+
+// SubscriptionSpec describes a subscription filter. DestinationArn is a Lambda function,
+// Kinesis stream or Firehose stream; the latter two need a RoleArn that CloudWatch Logs assumes.
+type SubscriptionSpec struct {
+	Name           string `yaml:"name"`
+	Group          string `yaml:"group"`
+	Pattern        string `yaml:"pattern"`
+	DestinationArn string `yaml:"destination"`
+	RoleArn        string `yaml:"role"`
+	// Random distributes events over Kinesis shards instead of grouping them by stream
+	Random bool `yaml:"random"`
+}
+
+// FiltersFile is the layout of a filters YAML file.
+type FiltersFile struct {
+	MetricFilters []MetricFilterSpec `yaml:"metricFilters"`
+	Subscriptions []SubscriptionSpec `yaml:"subscriptions"`
+}
+
+// LoadFilters reads a filters YAML file.
+func LoadFilters(path string) (*FiltersFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f FiltersFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// PutMetricFilter creates or replaces a metric filter.
+func PutMetricFilter(ctx context.Context, svc *cloudwatchlogs.Client, spec MetricFilterSpec) error {
+	transform := types.MetricTransformation{
+		MetricName:      aws.String(spec.MetricName),
+		MetricNamespace: aws.String(spec.Namespace),
+		MetricValue:     aws.String(spec.Value),
+		DefaultValue:    spec.DefaultValue,
+	}
+	if spec.Value == "" {
+		transform.MetricValue = aws.String("1")
+	}
+	if spec.Unit != "" {
+		transform.Unit = types.StandardUnit(spec.Unit)
+	}
+	_, err := svc.PutMetricFilter(ctx, &cloudwatchlogs.PutMetricFilterInput{
+		FilterName:            aws.String(spec.Name),
+		LogGroupName:          aws.String(spec.Group),
+		FilterPattern:         aws.String(spec.Pattern),
+		MetricTransformations: []types.MetricTransformation{transform},
+	})
+	if err != nil {
+		return fmt.Errorf("put metric filter %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// ListMetricFilters returns the metric filters of a group whose name starts with prefix.
+func ListMetricFilters(ctx context.Context, svc *cloudwatchlogs.Client, group, prefix string) ([]types.MetricFilter, error) {
+	input := &cloudwatchlogs.DescribeMetricFiltersInput{LogGroupName: aws.String(group)}
+	if prefix != "" {
+		input.FilterNamePrefix = aws.String(prefix)
+	}
+	var filters []types.MetricFilter
+	paginator := cloudwatchlogs.NewDescribeMetricFiltersPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe metric filters of %s: %w", group, err)
+		}
+		filters = append(filters, page.MetricFilters...)
+	}
+	return filters, nil
+}
+
+// DeleteMetricFilter deletes a metric filter.
+func DeleteMetricFilter(ctx context.Context, svc *cloudwatchlogs.Client, group, name string) error {
+	_, err := svc.DeleteMetricFilter(ctx, &cloudwatchlogs.DeleteMetricFilterInput{
+		LogGroupName: aws.String(group),
+		FilterName:   aws.String(name),
+	})
+	return err
+}
+
+// PutSubscriptionFilter creates or replaces a subscription filter. A Lambda destination must
+// allow logs.amazonaws.com to invoke it.
+func PutSubscriptionFilter(ctx context.Context, svc *cloudwatchlogs.Client, spec SubscriptionSpec) error {
+	if spec.RoleArn == "" && !strings.Contains(spec.DestinationArn, ":lambda:") {
+		return fmt.Errorf("subscription %s: destination %s needs a role", spec.Name, spec.DestinationArn)
+	}
+	input := &cloudwatchlogs.PutSubscriptionFilterInput{
+		FilterName:     aws.String(spec.Name),
+		LogGroupName:   aws.String(spec.Group),
+		FilterPattern:  aws.String(spec.Pattern),
+		DestinationArn: aws.String(spec.DestinationArn),
+	}
+	if spec.RoleArn != "" {
+		input.RoleArn = aws.String(spec.RoleArn)
+	}
+	if spec.Random {
+		input.Distribution = types.DistributionRandom
+	}
+	if _, err := svc.PutSubscriptionFilter(ctx, input); err != nil {
+		return fmt.Errorf("put subscription filter %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// ListSubscriptionFilters returns the subscription filters of a group.
+func ListSubscriptionFilters(ctx context.Context, svc *cloudwatchlogs.Client, group string) ([]types.SubscriptionFilter, error) {
+	var filters []types.SubscriptionFilter
+	paginator := cloudwatchlogs.NewDescribeSubscriptionFiltersPaginator(svc, &cloudwatchlogs.DescribeSubscriptionFiltersInput{
+		LogGroupName: aws.String(group),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe subscription filters of %s: %w", group, err)
+		}
+		filters = append(filters, page.SubscriptionFilters...)
+	}
+	return filters, nil
+}
+
+// DeleteSubscriptionFilter deletes a subscription filter.
+func DeleteSubscriptionFilter(ctx context.Context, svc *cloudwatchlogs.Client, group, name string) error {
+	_, err := svc.DeleteSubscriptionFilter(ctx, &cloudwatchlogs.DeleteSubscriptionFilterInput{
+		LogGroupName: aws.String(group),
+		FilterName:   aws.String(name),
+	})
+	return err
+}
+
+// TestPattern runs TestMetricFilter and returns the index of every matching message, in the
+// order of messages, with the values extracted by the pattern.
+func TestPattern(ctx context.Context, svc *cloudwatchlogs.Client, pattern string, messages []string) (map[int]map[string]string, error) {
+	out, err := svc.TestMetricFilter(ctx, &cloudwatchlogs.TestMetricFilterInput{
+		FilterPattern:    aws.String(pattern),
+		LogEventMessages: messages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("test pattern %s: %w", pattern, err)
+	}
+	// EventNumber counts messages from 1
+	matches := make(map[int]map[string]string, len(out.Matches))
+	for _, m := range out.Matches {
+		matches[int(m.EventNumber)-1] = m.ExtractedValues
+	}
+	return matches, nil
+}
+
+// CheckFilters tests every metric filter pattern against its samples and returns one line per
+// sample that does not match as expected.
+func CheckFilters(ctx context.Context, svc *cloudwatchlogs.Client, filters []MetricFilterSpec) ([]string, error) {
+	var failures []string
+	for _, f := range filters {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		messages := make([]string, len(f.Samples))
+		for i, s := range f.Samples {
+			messages[i] = s.Message
+		}
+		matches, err := TestPattern(ctx, svc, f.Pattern, messages)
+		if err != nil {
+			return failures, err
+		}
+		for i, s := range f.Samples {
+			if _, matched := matches[i]; matched != s.Match {
+				failures = append(failures, fmt.Sprintf("%s: sample %d matched=%t, want %t: %s", f.Name, i+1, matched, s.Match, s.Message))
+			}
+		}
+	}
+	return failures, nil
+}
+
+// readMessages reads one message per line.
+func readMessages(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var messages []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxEventBytes)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			messages = append(messages, scanner.Text())
+		}
+	}
+	return messages, scanner.Err()
+}
+
+// FilterCommand handles metric and subscription filters.
+//
+//	filter metric-put -name errors -pattern '{ $.level = "ERROR" }' -metric ErrorCount -namespace App
+//	filter metric-list [-group my-log-group]
+//	filter metric-delete -name errors
+//	filter sub-put -name to-lambda -pattern ERROR -destination arn:aws:lambda:us-east-1:000000000000:function:my-function
+//	filter sub-put -name to-kinesis -destination arn:aws:kinesis:...:stream/logs -role arn:aws:iam::000000000000:role/cwl
+//	filter sub-list
+//	filter sub-delete -name to-lambda
+//	filter test -pattern '[ip, user, ts, request, status=5*, size]' -messages samples.log
+//	filter check -file cmd/cloudWatch/filters.yaml
+//	filter apply -file cmd/cloudWatch/filters.yaml
+func FilterCommand(svc *cloudwatchlogs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: filter metric-put|metric-list|metric-delete|sub-put|sub-list|sub-delete|test|check|apply [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("filter "+action, flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	name := fs.String("name", "", "filter name, a name prefix for metric-list")
+	pattern := fs.String("pattern", "", "filter pattern")
+	metric := fs.String("metric", "", "metric name (metric-put only)")
+	namespace := fs.String("namespace", "LocalStack", "metric namespace (metric-put only)")
+	value := fs.String("value", "1", "metric value or $.field (metric-put only)")
+	defaultValue := fs.String("default", "", "value for periods without events (metric-put only)")
+	destination := fs.String("destination", "", "Lambda, Kinesis or Firehose ARN (sub-put only)")
+	role := fs.String("role", "", "role ARN for Kinesis and Firehose (sub-put only)")
+	random := fs.Bool("random", false, "random distribution over Kinesis shards (sub-put only)")
+	messages := fs.String("messages", "", "file with one sample message per line (test only)")
+	file := fs.String("file", "cmd/cloudWatch/filters.yaml", "filters file (check and apply only)")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	switch action {
+	case "metric-put":
+		spec := MetricFilterSpec{Name: *name, Group: *group, Pattern: *pattern, MetricName: *metric, Namespace: *namespace, Value: *value}
+		if *defaultValue != "" {
+			v, err := strconv.ParseFloat(*defaultValue, 64)
+			if err != nil {
+				return fmt.Errorf("-default: %w", err)
+			}
+			spec.DefaultValue = &v
+		}
+		return PutMetricFilter(ctx, svc, spec)
+	case "metric-list":
+		filters, err := ListMetricFilters(ctx, svc, *group, *name)
+		if err != nil {
+			return err
+		}
+		for _, f := range filters {
+			log.Printf("* %s: %s\n", aws.ToString(f.FilterName), aws.ToString(f.FilterPattern))
+			for _, t := range f.MetricTransformations {
+				log.Printf("    %s/%s = %s\n", aws.ToString(t.MetricNamespace), aws.ToString(t.MetricName), aws.ToString(t.MetricValue))
+			}
+		}
+		return nil
+	case "metric-delete":
+		return DeleteMetricFilter(ctx, svc, *group, *name)
+	case "sub-put":
+		return PutSubscriptionFilter(ctx, svc, SubscriptionSpec{
+			Name: *name, Group: *group, Pattern: *pattern, DestinationArn: *destination, RoleArn: *role, Random: *random,
+		})
+	case "sub-list":
+		filters, err := ListSubscriptionFilters(ctx, svc, *group)
+		if err != nil {
+			return err
+		}
+		for _, f := range filters {
+			log.Printf("* %s: %s -> %s\n", aws.ToString(f.FilterName), aws.ToString(f.FilterPattern), aws.ToString(f.DestinationArn))
+		}
+		return nil
+	case "sub-delete":
+		return DeleteSubscriptionFilter(ctx, svc, *group, *name)
+	case "test":
+		msgs, err := readMessages(*messages)
+		if err != nil {
+			return err
+		}
+		matches, err := TestPattern(ctx, svc, *pattern, msgs)
+		if err != nil {
+			return err
+		}
+		for i, msg := range msgs {
+			if values, ok := matches[i]; ok {
+				log.Printf("MATCH %s %v\n", msg, values)
+			} else {
+				log.Printf("      %s\n", msg)
+			}
+		}
+		log.Printf("%d of %d messages match\n", len(matches), len(msgs))
+		return nil
+	case "check", "apply":
+		f, err := LoadFilters(*file)
+		if err != nil {
+			return err
+		}
+		failures, err := CheckFilters(ctx, svc, f.MetricFilters)
+		if err != nil {
+			return err
+		}
+		for _, failure := range failures {
+			log.Printf("FAIL %s\n", failure)
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%d samples do not match as expected", len(failures))
+		}
+		log.Printf("All samples of %d metric filters match as expected\n", len(f.MetricFilters))
+		if action == "check" {
+			return nil
+		}
+
+		for _, spec := range f.MetricFilters {
+			if err := PutMetricFilter(ctx, svc, spec); err != nil {
+				return err
+			}
+			log.Printf("Put metric filter %s on %s\n", spec.Name, spec.Group)
+		}
+		for _, spec := range f.Subscriptions {
+			if err := PutSubscriptionFilter(ctx, svc, spec); err != nil {
+				return err
+			}
+			log.Printf("Put subscription filter %s on %s\n", spec.Name, spec.Group)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown filter action %q", action)
+}
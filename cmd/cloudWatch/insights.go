@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of query results
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// Query is a Logs Insights query over a time range.
+type Query struct {
+	Groups []string
+	Query  string
+	Start  time.Time
+	End    time.Time
+	// Limit of result rows, 0 uses the service default of 1000
+	Limit int32
+}
+
+// QueryResult is the outcome of a completed query.
+type QueryResult struct {
+	QueryID    string
+	Columns    []string
+	Rows       []map[string]string
+	Statistics types.QueryStatistics
+}
+
+// SavedQuery is an entry of a saved queries file.
+type SavedQuery struct {
+	Description string   `yaml:"description"`
+	Groups      []string `yaml:"groups"`
+	Query       string   `yaml:"query"`
+	// Since is the default start, e.g. 1h
+	Since string `yaml:"since"`
+}
+
+// LoadSavedQueries reads saved queries by name from a YAML file:
+//
+//	errors:
+//	  description: Latest errors
+//	  groups: [my-log-group]
+//	  since: 1h
+//	  query: |
+//	    fields @timestamp, @message | filter level = "error" | sort @timestamp desc
+func LoadSavedQueries(path string) (map[string]SavedQuery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var queries map[string]SavedQuery
+	if err := yaml.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return queries, nil
+}
+
+// RunQuery starts the query and polls its results every interval until it completes. When ctx
+// is cancelled the query is stopped.
+func RunQuery(ctx context.Context, svc *cloudwatchlogs.Client, q Query, interval time.Duration) (*QueryResult, error) {
+	input := &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: q.Groups,
+		QueryString:   aws.String(q.Query),
+		StartTime:     aws.Int64(q.Start.Unix()),
+		EndTime:       aws.Int64(q.End.Unix()),
+	}
+	if q.Limit > 0 {
+		input.Limit = aws.Int32(q.Limit)
+	}
+	started, err := svc.StartQuery(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("start query: %w", err)
+	}
+	id := aws.ToString(started.QueryId)
+
+	for {
+		select {
+		case <-ctx.Done():
+			svc.StopQuery(context.WithoutCancel(ctx), &cloudwatchlogs.StopQueryInput{QueryId: aws.String(id)})
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		out, err := svc.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(id)})
+		if err != nil {
+			return nil, fmt.Errorf("get results of query %s: %w", id, err)
+		}
+		switch out.Status {
+		case types.QueryStatusComplete:
+			result := newQueryResult(out.Results)
+			result.QueryID = id
+			if out.Statistics != nil {
+				result.Statistics = *out.Statistics
+			}
+			return result, nil
+		case types.QueryStatusFailed, types.QueryStatusCancelled, types.QueryStatusTimeout:
+			return nil, fmt.Errorf("query %s: %s", id, out.Status)
+		}
+	}
+}
+
+// newQueryResult converts result rows to maps. Columns are in order of first appearance, the
+// internal @ptr field is left out.
+func newQueryResult(rows [][]types.ResultField) *QueryResult {
+	result := &QueryResult{Rows: make([]map[string]string, len(rows))}
+	known := map[string]bool{}
+	for i, fields := range rows {
+		result.Rows[i] = make(map[string]string, len(fields))
+		for _, f := range fields {
+			name := aws.ToString(f.Field)
+			if name == "@ptr" {
+				continue
+			}
+			if !known[name] {
+				known[name] = true
+				result.Columns = append(result.Columns, name)
+			}
+			result.Rows[i][name] = aws.ToString(f.Value)
+		}
+	}
+	return result
+}
+
+// WriteQueryResult writes the rows in the given format.
+func WriteQueryResult(w io.Writer, result *QueryResult, format string) error {
+	switch format {
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(result.Columns, "\t"))
+		for _, row := range result.Rows {
+			cells := make([]string, len(result.Columns))
+			for i, col := range result.Columns {
+				cells[i] = strings.ReplaceAll(row[col], "\n", " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result.Rows)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(result.Columns)
+		for _, row := range result.Rows {
+			cells := make([]string, len(result.Columns))
+			for i, col := range result.Columns {
+				cells[i] = row[col]
+			}
+			cw.Write(cells)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q, use table, json or csv", format)
+}
+
+// QueryCommand handles `query`, with the query given inline or by name from a saved queries file.
+//
+//	query -group my-log-group -since 1h -q 'fields @timestamp, @message | limit 20'
+//	query -saved errors -format csv
+//	query -list
+func QueryCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	groups := fs.String("group", LOG_GROUP_NAME, "comma separated log group names")
+	text := fs.String("q", "", "query string")
+	file := fs.String("file", "cmd/cloudWatch/queries.yaml", "saved queries file")
+	saved := fs.String("saved", "", "name of a saved query")
+	list := fs.Bool("list", false, "list the saved queries")
+	since := fs.String("since", "", "start, as a duration before now or a time, default 1h")
+	until := fs.String("until", "", "end, as a duration before now or a time, default now")
+	limit := fs.Int("limit", 0, "maximum rows")
+	format := fs.String("format", FormatTable, "output format: table, json or csv")
+	interval := fs.Duration("interval", time.Second, "poll interval")
+	fs.Parse(args)
+
+	q := Query{Query: *text, Groups: strings.Split(*groups, ","), Limit: int32(*limit)}
+	if *list || *saved != "" {
+		queries, err := LoadSavedQueries(*file)
+		if err != nil {
+			return err
+		}
+		if *list {
+			names := make([]string, 0, len(queries))
+			for name := range queries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				log.Printf("* %s: %s\n", name, queries[name].Description)
+			}
+			return nil
+		}
+
+		sq, ok := queries[*saved]
+		if !ok {
+			return fmt.Errorf("no saved query %q in %s", *saved, *file)
+		}
+		q.Query = sq.Query
+		if len(sq.Groups) > 0 && !flagSet(fs, "group") {
+			q.Groups = sq.Groups
+		}
+		if *since == "" {
+			*since = sq.Since
+		}
+	}
+	if q.Query == "" {
+		return errors.New("no query, use -q or -saved")
+	}
+	if *since == "" {
+		*since = "1h"
+	}
+
+	now := time.Now()
+	var err error
+	if q.Start, err = ParseTime(*since, now); err != nil {
+		return err
+	}
+	if q.End, err = ParseTime(*until, now); err != nil {
+		return err
+	}
+	if q.End.IsZero() {
+		q.End = now
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := RunQuery(ctx, svc, q, *interval)
+	if err != nil {
+		return err
+	}
+	if err := WriteQueryResult(os.Stdout, result, *format); err != nil {
+		return err
+	}
+	s := result.Statistics
+	log.Printf("%d rows, %.0f records matched, %.0f records scanned, %.0f bytes scanned\n",
+		len(result.Rows), s.RecordsMatched, s.RecordsScanned, s.BytesScanned)
+	return nil
+}
+
+// flagSet reports whether the flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -51,26 +50,51 @@ func main() {
 	// Create CloudWatch Logs client
 	svc := cloudwatchlogs.NewFromConfig(provider)
 
+	// Run a sub-command when one is given, e.g. `go run ./cmd/cloudWatch tail -follow`
+	if len(os.Args) > 1 {
+		RunCommand(provider, svc, os.Args[1], os.Args[2:])
+		return
+	}
+
 	//
 	PutLogEvents(svc)
 	GetLogEvents(svc)
 }
 
-func PutLogEvents(logsSvc *cloudwatchlogs.Client) {
-	//
-	isResourceAlreadyExistsError := func(err error) bool {
-		var (
-			rex *types.ResourceAlreadyExistsException
-		)
-		return errors.As(err, &rex)
+func RunCommand(provider aws.Config, svc *cloudwatchlogs.Client, name string, args []string) {
+	var err error
+	switch name {
+	case "tail":
+		err = TailCommand(svc, args)
+	case "sink":
+		err = SinkCommand(svc, args)
+	case "query":
+		err = QueryCommand(svc, args)
+	case "group":
+		err = GroupCommand(svc, args)
+	case "export":
+		err = ExportCommand(svc, args)
+	case "filter":
+		err = FilterCommand(svc, args)
+	case "logs":
+		err = LogsCommand(svc, args)
+	case "ingest":
+		err = IngestCommand(svc, args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
 	}
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
 
+func PutLogEvents(logsSvc *cloudwatchlogs.Client) {
 	// Ensure log group exists
 	_, err := logsSvc.CreateLogGroup(context.TODO(), &cloudwatchlogs.CreateLogGroupInput{
 		LogGroupName: aws.String(LOG_GROUP_NAME),
 	})
 	if err != nil {
-		if !isResourceAlreadyExistsError(err) {
+		if !IsResourceAlreadyExists(err) {
 			log.Println("Failed to create log group:", err)
 			return
 		}
@@ -82,7 +106,7 @@ func PutLogEvents(logsSvc *cloudwatchlogs.Client) {
 		LogStreamName: aws.String(LOG_STREAM_NAME),
 	})
 	if err != nil {
-		if !isResourceAlreadyExistsError(err) {
+		if !IsResourceAlreadyExists(err) {
 			log.Println("Failed to create log stream:", err)
 			return
 		}
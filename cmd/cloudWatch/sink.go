@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// PutLogEvents limits
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1024 * 1024
+	// eventOverhead is added to the message size of every event
+	eventOverhead   = 26
+	maxEventBytes   = 256 * 1024
+	maxBatchSpan    = 24 * time.Hour
+	defaultInterval = 5 * time.Second
+	// putAttempts is how often Flush tries a batch before putting it back in the buffer
+	putAttempts = 3
+)
+
+// ErrSinkClosed is returned when adding events to a closed Sink.
+var ErrSinkClosed = errors.New("cloudwatch sink is closed")
+
+// IsResourceAlreadyExists reports whether err is a ResourceAlreadyExistsException.
+func IsResourceAlreadyExists(err error) bool {
+	var rex *types.ResourceAlreadyExistsException
+	return errors.As(err, &rex)
+}
+
+// EnsureLogStream creates the log group and stream unless they exist.
+func EnsureLogStream(ctx context.Context, svc *cloudwatchlogs.Client, group, stream string) error {
+	_, err := svc.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(group),
+	})
+	if err != nil && !IsResourceAlreadyExists(err) {
+		return fmt.Errorf("create log group %s: %w", group, err)
+	}
+	_, err = svc.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+	if err != nil && !IsResourceAlreadyExists(err) {
+		return fmt.Errorf("create log stream %s: %w", stream, err)
+	}
+	return nil
+}
+
+// SinkOptions tunes when a Sink flushes. Zero values use the PutLogEvents limits and a 5s
+// interval.
+type SinkOptions struct {
+	FlushInterval time.Duration
+	MaxEvents     int
+	MaxBytes      int
+}
+
+// Sink buffers log events and sends them to a log stream with PutLogEvents. It flushes when the
+// buffer reaches MaxEvents or MaxBytes and every FlushInterval. Events are sent sorted by
+// timestamp, in batches spanning at most 24 hours. Sink is an io.Writer, each Write being one
+// event, so it can be the output of a log.Logger; NewSlogHandler makes an slog.Handler of it.
+//
+// Errors of background flushes are written to stderr, since the sink may be the log output
+// itself. A batch that cannot be sent is kept for the next flush. Close flushes the remaining
+// events and must be called before exiting; events added after Close fail with ErrSinkClosed.
+type Sink struct {
+	svc    *cloudwatchlogs.Client
+	group  string
+	stream string
+	opts   SinkOptions
+
+	mu     sync.Mutex
+	events []types.InputLogEvent
+	size   int
+	closed bool
+
+	// flushMu keeps batches in order when a size-triggered flush overlaps a timed one
+	flushMu sync.Mutex
+	full    chan struct{}
+	done    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// NewSink creates the group and stream if missing and starts the background flusher.
+func NewSink(ctx context.Context, svc *cloudwatchlogs.Client, group, stream string, opts SinkOptions) (*Sink, error) {
+	if err := EnsureLogStream(ctx, svc, group, stream); err != nil {
+		return nil, err
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultInterval
+	}
+	if opts.MaxEvents <= 0 || opts.MaxEvents > maxBatchEvents {
+		opts.MaxEvents = maxBatchEvents
+	}
+	if opts.MaxBytes <= 0 || opts.MaxBytes > maxBatchBytes {
+		opts.MaxBytes = maxBatchBytes
+	}
+
+	s := &Sink{
+		svc:    svc,
+		group:  group,
+		stream: stream,
+		opts:   opts,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.stopped.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+// Write adds p as one event timestamped now, without its trailing newline.
+func (s *Sink) Write(p []byte) (int, error) {
+	if err := s.Add(time.Now(), string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Add buffers an event. Messages over 256KB are truncated and empty messages are dropped.
+// It returns ErrSinkClosed once Close has been called.
+func (s *Sink) Add(ts time.Time, msg string) error {
+	msg = truncateUTF8(strings.TrimRight(msg, "\n"), maxEventBytes-eventOverhead)
+	if msg == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSinkClosed
+	}
+	s.events = append(s.events, types.InputLogEvent{
+		Message:   aws.String(msg),
+		Timestamp: aws.Int64(ts.UnixMilli()),
+	})
+	s.size += len(msg) + eventOverhead
+	full := len(s.events) >= s.opts.MaxEvents || s.size >= s.opts.MaxBytes
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// The character spanning the cut starts at most utf8.UTFMax-1 bytes before it
+	cut := n
+	for cut > n-utf8.UTFMax+1 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
+
+func (s *Sink) loop() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.full:
+		}
+		if err := s.Flush(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "cloudwatch sink %s/%s: %v\n", s.group, s.stream, err)
+		}
+	}
+}
+
+// Flush sends all buffered events. A batch failing putAttempts times with backoff is put back
+// in the buffer with the batches after it, to be sent by the next flush. Batches rejected as
+// invalid are dropped, as sending them again cannot succeed.
+func (s *Sink) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	events := s.events
+	s.events, s.size = nil, 0
+	s.mu.Unlock()
+
+	var errs []error
+	batches := splitBatches(events, s.opts.MaxEvents, s.opts.MaxBytes)
+	for i, batch := range batches {
+		out, err := s.putLogEvents(ctx, batch)
+		var invalid *types.InvalidParameterException
+		if errors.As(err, &invalid) {
+			errs = append(errs, fmt.Errorf("dropped %d invalid log events: %w", len(batch), err))
+			continue
+		}
+		if err != nil {
+			s.requeue(batches[i:])
+			errs = append(errs, fmt.Errorf("put %d log events, kept for the next flush: %w", len(batch), err))
+			break
+		}
+		if info := out.RejectedLogEventsInfo; info != nil {
+			errs = append(errs, fmt.Errorf("log events rejected: too old before index %d, expired before index %d, too new from index %d",
+				aws.ToInt32(info.TooOldLogEventEndIndex), aws.ToInt32(info.ExpiredLogEventEndIndex), aws.ToInt32(info.TooNewLogEventStartIndex)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// putLogEvents sends a batch, retrying with backoff.
+func (s *Sink) putLogEvents(ctx context.Context, batch []types.InputLogEvent) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := s.svc.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(s.stream),
+			LogEvents:     batch,
+		})
+		var invalid *types.InvalidParameterException
+		if err == nil || attempt == putAttempts || errors.As(err, &invalid) {
+			return out, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(time.Duration(1<<attempt) * 100 * time.Millisecond):
+		}
+	}
+}
+
+// requeue puts unsent batches back in front of the events added since the flush started.
+func (s *Sink) requeue(batches [][]types.InputLogEvent) {
+	var events []types.InputLogEvent
+	size := 0
+	for _, batch := range batches {
+		for _, event := range batch {
+			events = append(events, event)
+			size += len(aws.ToString(event.Message)) + eventOverhead
+		}
+	}
+	s.mu.Lock()
+	s.events = append(events, s.events...)
+	s.size += size
+	s.mu.Unlock()
+}
+
+// Close stops the background flusher and flushes the remaining events. Events that still cannot
+// be sent are lost and reported in the returned error.
+func (s *Sink) Close(ctx context.Context) error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.done)
+	})
+	s.stopped.Wait()
+	return s.Flush(ctx)
+}
+
+// splitBatches sorts events by timestamp, as PutLogEvents requires, and splits them into
+// batches within the count, size and 24 hour limits.
+func splitBatches(events []types.InputLogEvent, maxEvents, maxBytes int) [][]types.InputLogEvent {
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.ToInt64(events[i].Timestamp) < aws.ToInt64(events[j].Timestamp)
+	})
+
+	var (
+		batches [][]types.InputLogEvent
+		start   int
+		size    int
+	)
+	for i, event := range events {
+		n := len(aws.ToString(event.Message)) + eventOverhead
+		span := time.Duration(aws.ToInt64(event.Timestamp)-aws.ToInt64(events[start].Timestamp)) * time.Millisecond
+		if i > start && (i-start == maxEvents || size+n > maxBytes || span >= maxBatchSpan) {
+			batches = append(batches, events[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(events) {
+		batches = append(batches, events[start:])
+	}
+	return batches
+}
+
+// sinkHandler is an slog.Handler that formats records as JSON and adds them to a Sink with the
+// record time as timestamp.
+type sinkHandler struct {
+	slog.Handler
+	w *recordWriter
+}
+
+// recordWriter passes the time of the record being handled to the sink. Handlers derived with
+// WithAttrs and WithGroup share it, mu serializes their records.
+type recordWriter struct {
+	mu   sync.Mutex
+	sink *Sink
+	ts   time.Time
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	if err := w.sink.Add(w.ts, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewSlogHandler returns an slog.Handler writing JSON records to the sink.
+func NewSlogHandler(sink *Sink, opts *slog.HandlerOptions) slog.Handler {
+	w := &recordWriter{sink: sink}
+	return &sinkHandler{Handler: slog.NewJSONHandler(w, opts), w: w}
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.ts = r.Time
+	if h.w.ts.IsZero() {
+		h.w.ts = time.Now()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
+
+// SinkCommand handles `sink -group my-log-group -stream my-app -count 100`. It logs through both
+// a log.Logger and slog into the stream and flushes on exit.
+func SinkCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("sink", flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	stream := fs.String("stream", LOG_STREAM_NAME, "log stream name")
+	count := fs.Int("count", 100, "events to write with each logger")
+	interval := fs.Duration("interval", defaultInterval, "flush interval")
+	fs.Parse(args)
+
+	ctx := context.TODO()
+	sink, err := NewSink(ctx, svc, *group, *stream, SinkOptions{FlushInterval: *interval})
+	if err != nil {
+		return err
+	}
+
+	std := log.New(sink, "", log.LstdFlags)
+	logger := slog.New(NewSlogHandler(sink, nil)).With("app", "sink-demo")
+	for i := 0; i < *count; i++ {
+		std.Printf("log.Logger event %d", i)
+		logger.Info("slog event", "n", i, "level_check", i%10 == 0)
+		if i%10 == 0 {
+			logger.Error("something failed", "n", i, "err", errors.New("demo error"))
+		}
+	}
+
+	if err := sink.Close(ctx); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d events to %s/%s\n", 2**count+(*count+9)/10, *group, *stream)
+	return nil
+}
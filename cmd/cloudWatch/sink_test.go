@@ -0,0 +1,149 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+func testEvent(ts time.Duration, msg string) types.InputLogEvent {
+	return types.InputLogEvent{Timestamp: aws.Int64(ts.Milliseconds()), Message: aws.String(msg)}
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    []types.InputLogEvent
+		maxEvents int
+		maxBytes  int
+		// want is the number of events of every batch
+		want []int
+	}{
+		{
+			name:      "empty",
+			maxEvents: 10, maxBytes: 1000,
+			want: nil,
+		},
+		{
+			name:      "one batch",
+			events:    []types.InputLogEvent{testEvent(0, "a"), testEvent(1, "b"), testEvent(2, "c")},
+			maxEvents: 10, maxBytes: 1000,
+			want: []int{3},
+		},
+		{
+			name: "event count",
+			events: []types.InputLogEvent{
+				testEvent(0, "a"), testEvent(1, "b"), testEvent(2, "c"), testEvent(3, "d"), testEvent(4, "e"),
+			},
+			maxEvents: 2, maxBytes: 1000,
+			want: []int{2, 2, 1},
+		},
+		{
+			// Every event counts 10 bytes plus the overhead
+			name: "bytes",
+			events: []types.InputLogEvent{
+				testEvent(0, strings.Repeat("a", 10)),
+				testEvent(1, strings.Repeat("b", 10)),
+				testEvent(2, strings.Repeat("c", 10)),
+			},
+			maxEvents: 10, maxBytes: 2 * (10 + eventOverhead),
+			want: []int{2, 1},
+		},
+		{
+			name:      "bytes, one byte short",
+			events:    []types.InputLogEvent{testEvent(0, strings.Repeat("a", 10)), testEvent(1, strings.Repeat("b", 10))},
+			maxEvents: 10, maxBytes: 2*(10+eventOverhead) - 1,
+			want: []int{1, 1},
+		},
+		{
+			name:      "oversized event gets its own batch",
+			events:    []types.InputLogEvent{testEvent(0, "a"), testEvent(1, strings.Repeat("b", 100)), testEvent(2, "c")},
+			maxEvents: 10, maxBytes: 50,
+			want: []int{1, 1, 1},
+		},
+		{
+			name: "24 hour span",
+			events: []types.InputLogEvent{
+				testEvent(0, "a"),
+				testEvent(maxBatchSpan-time.Millisecond, "b"),
+				testEvent(maxBatchSpan, "c"),
+				testEvent(2*maxBatchSpan-time.Millisecond, "d"),
+				testEvent(2*maxBatchSpan, "e"),
+			},
+			maxEvents: 10, maxBytes: 1000,
+			want: []int{2, 2, 1},
+		},
+		{
+			name: "sorted before splitting",
+			events: []types.InputLogEvent{
+				testEvent(maxBatchSpan, "c"),
+				testEvent(0, "a"),
+				testEvent(time.Hour, "b"),
+			},
+			maxEvents: 10, maxBytes: 1000,
+			want: []int{2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := splitBatches(tt.events, tt.maxEvents, tt.maxBytes)
+			var got []int
+			for _, batch := range batches {
+				got = append(got, len(batch))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("batch sizes = %v, want %v", got, tt.want)
+			}
+
+			var last int64
+			for _, batch := range batches {
+				first := aws.ToInt64(batch[0].Timestamp)
+				for _, event := range batch {
+					ts := aws.ToInt64(event.Timestamp)
+					if ts < last {
+						t.Errorf("event at %d after %d", ts, last)
+					}
+					if span := time.Duration(ts-first) * time.Millisecond; span >= maxBatchSpan {
+						t.Errorf("batch spans %s", span)
+					}
+					last = ts
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"short", "abc", 5, "abc"},
+		{"exact", "abc", 3, "abc"},
+		{"ascii", "abcdef", 4, "abcd"},
+		{"at boundary", "aé", 3, "aé"},
+		{"inside 2 bytes", "aéb", 2, "a"},
+		{"inside 3 bytes", "a€", 3, "a"},
+		{"after 3 bytes", "a€b", 4, "a€"},
+		{"inside 4 bytes, 1 byte in", "a😀", 2, "a"},
+		{"inside 4 bytes, 3 bytes in", "a😀", 4, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUTF8(tt.s, tt.n)
+			if got != tt.want {
+				t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateUTF8(%q, %d) = %q is not valid UTF-8", tt.s, tt.n, got)
+			}
+		})
+	}
+}
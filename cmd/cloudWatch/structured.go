@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Pseudo fields of an event, usable in filters and columns next to the JSON fields
+const (
+	fieldTimestamp = "@timestamp"
+	fieldStream    = "@logStream"
+	fieldMessage   = "@message"
+)
+
+// timeFields are the fields holding the event time of a JSON log line, in order of preference.
+var timeFields = []string{"@timestamp", "timestamp", "time", "ts"}
+
+// ParseMessage parses a message that is a JSON object. Numbers are kept as json.Number.
+func ParseMessage(msg string) (map[string]any, bool) {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, "{") {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(msg))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+// LookupField returns a field by its path, with dots separating nested objects, e.g. req.id.
+func LookupField(fields map[string]any, path string) (any, bool) {
+	if v, ok := fields[path]; ok {
+		return v, true
+	}
+	var cur any = fields
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// formatField renders a field value, objects and arrays as JSON.
+func formatField(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// FieldFilter is a condition on a field: field=value, field!=value, field~substring, or a
+// numeric comparison with <, <=, > or >=. Equality of strings ignores case, so level=error
+// matches "ERROR".
+type FieldFilter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// filterOps in the order they are looked for, longest first
+var filterOps = []string{"!=", "<=", ">=", "=", "~", "<", ">"}
+
+// ParseFieldFilter parses a condition such as level=error or latency>=100.
+func ParseFieldFilter(s string) (FieldFilter, error) {
+	at, op := -1, ""
+	for _, o := range filterOps {
+		if i := strings.Index(s, o); i >= 0 && (at < 0 || i < at || i == at && len(o) > len(op)) {
+			at, op = i, o
+		}
+	}
+	if at < 0 {
+		return FieldFilter{}, fmt.Errorf("filter %q has no operator, use one of %v", s, filterOps)
+	}
+	f := FieldFilter{Field: strings.TrimSpace(s[:at]), Op: op, Value: strings.TrimSpace(s[at+len(op):])}
+	if f.Field == "" {
+		return FieldFilter{}, fmt.Errorf("filter %q has no field before %s", s, op)
+	}
+	return f, nil
+}
+
+// Match reports whether the field value satisfies the filter. A missing field only matches !=.
+func (f FieldFilter) Match(fields map[string]any) bool {
+	v, ok := LookupField(fields, f.Field)
+	if !ok {
+		return f.Op == "!="
+	}
+	s := formatField(v)
+	switch f.Op {
+	case "=":
+		return strings.EqualFold(s, f.Value)
+	case "!=":
+		return !strings.EqualFold(s, f.Value)
+	case "~":
+		return strings.Contains(strings.ToLower(s), strings.ToLower(f.Value))
+	}
+
+	x, err1 := strconv.ParseFloat(s, 64)
+	y, err2 := strconv.ParseFloat(f.Value, 64)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	switch f.Op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+// StructuredEvent is a log event with the fields of its JSON message and the pseudo fields
+// @timestamp, @logStream and @message. They are kept apart, so a message may have fields with
+// the same names.
+type StructuredEvent struct {
+	// Fields of the JSON message, empty for other messages
+	Fields map[string]any
+	Pseudo map[string]any
+	// Structured is set when the message is a JSON object
+	Structured bool
+}
+
+// NewStructuredEvent parses the message of an event.
+func NewStructuredEvent(event types.FilteredLogEvent) StructuredEvent {
+	msg := aws.ToString(event.Message)
+	fields, ok := ParseMessage(msg)
+	if !ok {
+		fields = map[string]any{}
+	}
+	pseudo := map[string]any{
+		fieldTimestamp: time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC().Format("2006-01-02T15:04:05.000Z"),
+		fieldStream:    aws.ToString(event.LogStreamName),
+		fieldMessage:   strings.TrimRight(msg, "\n"),
+	}
+	return StructuredEvent{Fields: fields, Pseudo: pseudo, Structured: ok}
+}
+
+// Merged returns the fields of the message and the pseudo fields it does not have itself.
+func (e StructuredEvent) Merged() map[string]any {
+	out := make(map[string]any, len(e.Fields)+len(e.Pseudo))
+	for k, v := range e.Pseudo {
+		out[k] = v
+	}
+	for k, v := range e.Fields {
+		out[k] = v
+	}
+	return out
+}
+
+// StructuredPrinter writes the events matching all filters, projected to columns as a table or
+// as JSON lines. Without columns, JSON lines hold the whole JSON message plus the pseudo fields
+// it does not have itself, and the table becomes a plain line of time, stream and message.
+// Filters and columns see the fields of the message first, then the pseudo fields. When
+// filters are given, messages that are not JSON are skipped.
+type StructuredPrinter struct {
+	Filters []FieldFilter
+	Columns []string
+	JSON    bool
+
+	w       io.Writer
+	table   *tabwriter.Writer
+	printed int
+}
+
+// NewStructuredPrinter returns a printer writing to w. Call Flush when done.
+func NewStructuredPrinter(w io.Writer, filters []FieldFilter, columns []string, asJSON bool) *StructuredPrinter {
+	p := &StructuredPrinter{Filters: filters, Columns: columns, JSON: asJSON, w: w}
+	if !asJSON && len(columns) > 0 {
+		p.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(p.table, strings.ToUpper(strings.Join(columns, "\t")))
+	}
+	return p
+}
+
+// Print writes the event if it matches.
+func (p *StructuredPrinter) Print(event types.FilteredLogEvent) error {
+	e := NewStructuredEvent(event)
+	if len(p.Filters) > 0 && !e.Structured {
+		return nil
+	}
+	fields := e.Merged()
+	for _, f := range p.Filters {
+		if !f.Match(fields) {
+			return nil
+		}
+	}
+	p.printed++
+
+	switch {
+	case p.JSON:
+		out := fields
+		if len(p.Columns) > 0 {
+			out = make(map[string]any, len(p.Columns))
+			for _, col := range p.Columns {
+				if v, ok := LookupField(fields, col); ok {
+					out[col] = v
+				}
+			}
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", b)
+		return err
+	case p.table != nil:
+		cells := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			v, _ := LookupField(fields, col)
+			cells[i] = strings.ReplaceAll(formatField(v), "\t", " ")
+		}
+		_, err := fmt.Fprintln(p.table, strings.Join(cells, "\t"))
+		return err
+	default:
+		_, err := fmt.Fprintf(p.w, "%s %s %s\n", e.Pseudo[fieldTimestamp], e.Pseudo[fieldStream], e.Pseudo[fieldMessage])
+		return err
+	}
+}
+
+// Flush writes the buffered table rows.
+func (p *StructuredPrinter) Flush() error {
+	if p.table != nil {
+		return p.table.Flush()
+	}
+	return nil
+}
+
+// EventTime returns the time of a JSON log line from its @timestamp, timestamp, time or ts
+// field, as RFC 3339 or as epoch seconds or milliseconds.
+func EventTime(fields map[string]any) (time.Time, bool) {
+	for _, name := range timeFields {
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t, true
+			}
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				continue
+			}
+			// Epoch seconds are below 1e11 until the year 5138
+			if f < 1e11 {
+				sec, frac := math.Modf(f)
+				return time.Unix(int64(sec), int64(frac*1e9)), true
+			}
+			return time.UnixMilli(int64(f)), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// IngestJSONLines adds every line of r to the sink with the time of its time field, or now for
+// lines without one. It returns the number of lines and of lines without time.
+func IngestJSONLines(r io.Reader, sink *Sink) (lines, untimed int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxEventBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		ts, ok := time.Time{}, false
+		if fields, isJSON := ParseMessage(line); isJSON {
+			ts, ok = EventTime(fields)
+		}
+		if !ok {
+			ts = time.Now()
+			untimed++
+		}
+		if err := sink.Add(ts, line); err != nil {
+			return lines, untimed, err
+		}
+	}
+	return lines, untimed, scanner.Err()
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// LogsCommand handles `logs`, which reads structured logs with field filters and columns.
+//
+//	logs -group my-log-group -since 1h -where level=error -where requestId=abc
+//	logs -where 'latency>=500' -fields @timestamp,level,msg,latency -follow
+//	logs -where level=error -fields time,msg -json
+func LogsCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	prefix := fs.String("stream-prefix", "", "log stream name prefix")
+	since := fs.String("since", "1h", "start, as a duration before now or a time")
+	until := fs.String("until", "", "end, as a duration before now or a time")
+	pattern := fs.String("filter", "", "CloudWatch filter pattern applied before the field filters")
+	fields := fs.String("fields", "", "comma separated fields to show as columns")
+	asJSON := fs.Bool("json", false, "write JSON lines instead of a table")
+	follow := fs.Bool("follow", false, "keep polling for new events")
+	var where stringList
+	fs.Var(&where, "where", "field condition like level=error, repeatable")
+	fs.Parse(args)
+
+	var filters []FieldFilter
+	for _, w := range where {
+		f, err := ParseFieldFilter(w)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, f)
+	}
+	var columns []string
+	if *fields != "" {
+		columns = strings.Split(*fields, ",")
+	}
+
+	now := time.Now()
+	opts := TailOptions{Group: *group, StreamPrefix: *prefix, Pattern: *pattern, Follow: *follow}
+	var err error
+	if opts.Since, err = ParseTime(*since, now); err != nil {
+		return err
+	}
+	if opts.Until, err = ParseTime(*until, now); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	printer := NewStructuredPrinter(os.Stdout, filters, columns, *asJSON)
+	err = TailLogs(ctx, svc, opts, func(event types.FilteredLogEvent) error {
+		if err := printer.Print(event); err != nil {
+			return err
+		}
+		// Show events as they come when following, columns then only fit the rows of a poll
+		if *follow {
+			return printer.Flush()
+		}
+		return nil
+	})
+	if ferr := printer.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%d matching events\n", printer.printed)
+	return nil
+}
+
+// IngestCommand handles `ingest -file app.jsonl -group my-log-group -stream my-app`, uploading
+// a JSON Lines file with the original timestamps of its lines.
+func IngestCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	stream := fs.String("stream", LOG_STREAM_NAME, "log stream name")
+	file := fs.String("file", "-", "JSON Lines file, - for stdin")
+	fs.Parse(args)
+
+	r := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.TODO()
+	// Flush on size only, the whole file is sent by Close
+	sink, err := NewSink(ctx, svc, *group, *stream, SinkOptions{FlushInterval: time.Hour})
+	if err != nil {
+		return err
+	}
+	lines, untimed, err := IngestJSONLines(r, sink)
+	if cerr := sink.Close(ctx); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Ingested %d lines into %s/%s, %d without a time field were stamped now\n", lines, *group, *stream, untimed)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+func TestParseFieldFilter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FieldFilter
+	}{
+		{"level=error", FieldFilter{"level", "=", "error"}},
+		{"level!=debug", FieldFilter{"level", "!=", "debug"}},
+		{"latency>=100", FieldFilter{"latency", ">=", "100"}},
+		{"latency<=100", FieldFilter{"latency", "<=", "100"}},
+		{"latency>100", FieldFilter{"latency", ">", "100"}},
+		{"latency<100", FieldFilter{"latency", "<", "100"}},
+		{"msg~timeout", FieldFilter{"msg", "~", "timeout"}},
+		{"user.id=42", FieldFilter{"user.id", "=", "42"}},
+		{" level = error ", FieldFilter{"level", "=", "error"}},
+		{"msg=", FieldFilter{"msg", "=", ""}},
+		// The earliest operator wins, the rest belongs to the value
+		{"msg~a=b", FieldFilter{"msg", "~", "a=b"}},
+		{"url=a>=b", FieldFilter{"url", "=", "a>=b"}},
+		{"expr=a!=b", FieldFilter{"expr", "=", "a!=b"}},
+		{"a<b>c", FieldFilter{"a", "<", "b>c"}},
+		// At the same position the longer operator wins
+		{"a>=b=c", FieldFilter{"a", ">=", "b=c"}},
+		{"a!=b", FieldFilter{"a", "!=", "b"}},
+		{"a<==b", FieldFilter{"a", "<=", "=b"}},
+		{"a=!b", FieldFilter{"a", "=", "!b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFieldFilter(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFieldFilter(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFieldFilterErrors(t *testing.T) {
+	for _, in := range []string{"", "level", "=error", ">=100", " ~x"} {
+		if f, err := ParseFieldFilter(in); err == nil {
+			t.Errorf("ParseFieldFilter(%q) = %+v, want an error", in, f)
+		}
+	}
+}
+
+func TestStructuredPrinter(t *testing.T) {
+	event := types.FilteredLogEvent{
+		Timestamp:     aws.Int64(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli()),
+		LogStreamName: aws.String("app"),
+		Message:       aws.String(`{"@timestamp":"2024-01-02T03:04:04Z","@message":"started","level":"info"}` + "\n"),
+	}
+	plain := types.FilteredLogEvent{
+		Timestamp:     event.Timestamp,
+		LogStreamName: aws.String("app"),
+		Message:       aws.String("plain line"),
+	}
+	tests := []struct {
+		name    string
+		filters []FieldFilter
+		columns []string
+		asJSON  bool
+		events  []types.FilteredLogEvent
+		want    string
+	}{
+		{
+			name:   "json keeps the message fields",
+			asJSON: true,
+			events: []types.FilteredLogEvent{event},
+			want:   `{"@logStream":"app","@message":"started","@timestamp":"2024-01-02T03:04:04Z","level":"info"}` + "\n",
+		},
+		{
+			name:   "json of a plain message has the pseudo fields",
+			asJSON: true,
+			events: []types.FilteredLogEvent{plain},
+			want:   `{"@logStream":"app","@message":"plain line","@timestamp":"2024-01-02T03:04:05.000Z"}` + "\n",
+		},
+		{
+			name:   "plain output uses the event",
+			events: []types.FilteredLogEvent{event},
+			want:   `2024-01-02T03:04:05.000Z app {"@timestamp":"2024-01-02T03:04:04Z","@message":"started","level":"info"}` + "\n",
+		},
+		{
+			name:    "columns prefer the message fields",
+			columns: []string{"@timestamp", "@message", "@logStream"},
+			asJSON:  true,
+			events:  []types.FilteredLogEvent{event},
+			want:    `{"@logStream":"app","@message":"started","@timestamp":"2024-01-02T03:04:04Z"}` + "\n",
+		},
+		{
+			name:    "filter on a pseudo field",
+			filters: []FieldFilter{{"@logStream", "=", "app"}, {"@message", "=", "started"}},
+			columns: []string{"level"},
+			asJSON:  true,
+			events:  []types.FilteredLogEvent{event, plain},
+			want:    `{"level":"info"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			p := NewStructuredPrinter(&buf, tt.filters, tt.columns, tt.asJSON)
+			for _, e := range tt.events {
+				if err := p.Print(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
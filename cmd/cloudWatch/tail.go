@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// TailOptions selects the events of a tail.
+type TailOptions struct {
+	Group string
+	// Streams limits the tail to these streams, StreamPrefix to streams with this prefix
+	Streams      []string
+	StreamPrefix string
+	// Since and Until bound the event timestamps, zero values are open ends
+	Since time.Time
+	Until time.Time
+	// Pattern is a CloudWatch Logs filter pattern, e.g. ERROR or { $.level = "error" }
+	Pattern string
+	// Follow keeps polling for new events every PollInterval, default 1s
+	Follow       bool
+	PollInterval time.Duration
+}
+
+// TailLogs calls fn for every event of the group matching the options, oldest first within each
+// poll. With Follow it keeps polling from the newest timestamp seen until ctx is cancelled.
+// Events are deduplicated by ID, because a poll starts at the timestamp of the last event and
+// returns the events of that millisecond again.
+func TailLogs(ctx context.Context, svc *cloudwatchlogs.Client, opts TailOptions, fn func(types.FilteredLogEvent) error) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	var (
+		start = opts.Since
+		// Timestamps of the events printed, by event ID
+		seen   = map[string]int64{}
+		newest int64
+	)
+	for {
+		input := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(opts.Group),
+		}
+		if len(opts.Streams) > 0 {
+			input.LogStreamNames = opts.Streams
+		} else if opts.StreamPrefix != "" {
+			input.LogStreamNamePrefix = aws.String(opts.StreamPrefix)
+		}
+		if !start.IsZero() {
+			input.StartTime = aws.Int64(start.UnixMilli())
+		}
+		if !opts.Until.IsZero() {
+			input.EndTime = aws.Int64(opts.Until.UnixMilli())
+		}
+		if opts.Pattern != "" {
+			input.FilterPattern = aws.String(opts.Pattern)
+		}
+
+		// Pages may be empty while the search goes on, so follow the token and not the events
+		paginator := cloudwatchlogs.NewFilterLogEventsPaginator(svc, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("filter log events of %s: %w", opts.Group, err)
+			}
+			for _, event := range page.Events {
+				id := aws.ToString(event.EventId)
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				seen[id] = aws.ToInt64(event.Timestamp)
+				newest = max(newest, seen[id])
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !opts.Follow || (!opts.Until.IsZero() && time.Now().After(opts.Until)) {
+			return nil
+		}
+		// The next poll starts at the newest timestamp, only its events can be returned again
+		if newest > 0 {
+			start = time.UnixMilli(newest)
+			for id, ts := range seen {
+				if ts < newest {
+					delete(seen, id)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// streamColors are the ANSI colors of stream prefixes
+var streamColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+// EventPrinter writes events as "timestamp stream message" lines, with a color per stream.
+type EventPrinter struct {
+	W     io.Writer
+	Color bool
+	// Local prints timestamps in the local time zone instead of UTC
+	Local bool
+}
+
+// Print writes one event.
+func (p *EventPrinter) Print(event types.FilteredLogEvent) error {
+	ts := time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC()
+	if p.Local {
+		ts = ts.Local()
+	}
+	stream := aws.ToString(event.LogStreamName)
+	if p.Color {
+		h := fnv.New32a()
+		h.Write([]byte(stream))
+		stream = "\033[" + streamColors[h.Sum32()%uint32(len(streamColors))] + "m" + stream + "\033[0m"
+	}
+	_, err := fmt.Fprintf(p.W, "%s %s %s\n", ts.Format("2006-01-02T15:04:05.000"), stream, strings.TrimRight(aws.ToString(event.Message), "\n"))
+	return err
+}
+
+// ParseTime parses an absolute time (RFC 3339, date and time, or date) or a duration before now
+// such as 10m, 2h or 3d.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		var days int
+		if _, err := fmt.Sscanf(s, "%dd", &days); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a duration like 10m or a time like 2006-01-02T15:04:05Z", s)
+}
+
+// isTerminal reports whether f is a terminal, to color output only there.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// TailCommand handles `tail -group my-log-group -since 10m -follow -filter ERROR`.
+func TailCommand(svc *cloudwatchlogs.Client, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	group := fs.String("group", LOG_GROUP_NAME, "log group name")
+	streams := fs.String("streams", "", "comma separated log stream names, all streams if empty")
+	prefix := fs.String("stream-prefix", "", "log stream name prefix")
+	since := fs.String("since", "10m", "start, as a duration before now or a time")
+	until := fs.String("until", "", "end, as a duration before now or a time")
+	pattern := fs.String("filter", "", "filter pattern")
+	follow := fs.Bool("follow", false, "keep polling for new events")
+	interval := fs.Duration("interval", time.Second, "poll interval with -follow")
+	noColor := fs.Bool("no-color", false, "do not color stream names")
+	local := fs.Bool("local", false, "print local times instead of UTC")
+	fs.Parse(args)
+
+	now := time.Now()
+	opts := TailOptions{
+		Group:        *group,
+		StreamPrefix: *prefix,
+		Pattern:      *pattern,
+		Follow:       *follow,
+		PollInterval: *interval,
+	}
+	if *streams != "" {
+		opts.Streams = strings.Split(*streams, ",")
+	}
+	var err error
+	if opts.Since, err = ParseTime(*since, now); err != nil {
+		return err
+	}
+	if opts.Until, err = ParseTime(*until, now); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	printer := &EventPrinter{W: os.Stdout, Color: !*noColor && isTerminal(os.Stdout), Local: *local}
+	return TailLogs(ctx, svc, opts, printer.Print)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ItemToDynamoJSON converts an item to the DynamoDB-JSON shape ({"S": "..."}, {"N": "..."}, ...)
+// used by the AWS CLI and by table exports. Every attribute type round-trips without loss.
+func ItemToDynamoJSON(item map[string]types.AttributeValue) map[string]any {
+	out := make(map[string]any, len(item))
+	for k, v := range item {
+		out[k] = AttributeToDynamoJSON(v)
+	}
+	return out
+}
+
+// AttributeToDynamoJSON converts a single attribute value to its DynamoDB-JSON shape.
+func AttributeToDynamoJSON(av types.AttributeValue) map[string]any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": base64.StdEncoding.EncodeToString(v.Value)}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": true}
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		bs := make([]string, len(v.Value))
+		for i, b := range v.Value {
+			bs[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return map[string]any{"BS": bs}
+	case *types.AttributeValueMemberL:
+		l := make([]any, len(v.Value))
+		for i, e := range v.Value {
+			l[i] = AttributeToDynamoJSON(e)
+		}
+		return map[string]any{"L": l}
+	case *types.AttributeValueMemberM:
+		return map[string]any{"M": ItemToDynamoJSON(v.Value)}
+	}
+	return nil
+}
+
+// ItemFromDynamoJSON is the reverse of ItemToDynamoJSON.
+func ItemFromDynamoJSON(raw map[string]json.RawMessage) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(raw))
+	for k, v := range raw {
+		av, err := AttributeFromDynamoJSON(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", k, err)
+		}
+		item[k] = av
+	}
+	return item, nil
+}
+
+// AttributeFromDynamoJSON decodes a single DynamoDB-JSON value such as {"N": "42"}.
+func AttributeFromDynamoJSON(data json.RawMessage) (types.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("expected exactly one type descriptor, got %d", len(typed))
+	}
+	for t, v := range typed {
+		switch t {
+		case "S":
+			var s string
+			err := json.Unmarshal(v, &s)
+			return &types.AttributeValueMemberS{Value: s}, err
+		case "N":
+			var n string
+			err := json.Unmarshal(v, &n)
+			return &types.AttributeValueMemberN{Value: n}, err
+		case "B":
+			var b []byte // encoding/json decodes base64 into []byte
+			err := json.Unmarshal(v, &b)
+			return &types.AttributeValueMemberB{Value: b}, err
+		case "BOOL":
+			var b bool
+			err := json.Unmarshal(v, &b)
+			return &types.AttributeValueMemberBOOL{Value: b}, err
+		case "NULL":
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		case "SS":
+			var ss []string
+			err := json.Unmarshal(v, &ss)
+			return &types.AttributeValueMemberSS{Value: ss}, err
+		case "NS":
+			var ns []string
+			err := json.Unmarshal(v, &ns)
+			return &types.AttributeValueMemberNS{Value: ns}, err
+		case "BS":
+			var bs [][]byte
+			err := json.Unmarshal(v, &bs)
+			return &types.AttributeValueMemberBS{Value: bs}, err
+		case "L":
+			var raws []json.RawMessage
+			if err := json.Unmarshal(v, &raws); err != nil {
+				return nil, err
+			}
+			l := make([]types.AttributeValue, len(raws))
+			for i, r := range raws {
+				av, err := AttributeFromDynamoJSON(r)
+				if err != nil {
+					return nil, fmt.Errorf("[%d]: %w", i, err)
+				}
+				l[i] = av
+			}
+			return &types.AttributeValueMemberL{Value: l}, nil
+		case "M":
+			var raws map[string]json.RawMessage
+			if err := json.Unmarshal(v, &raws); err != nil {
+				return nil, err
+			}
+			m, err := ItemFromDynamoJSON(raws)
+			if err != nil {
+				return nil, err
+			}
+			return &types.AttributeValueMemberM{Value: m}, nil
+		default:
+			return nil, fmt.Errorf("unknown type descriptor %q", t)
+		}
+	}
+	return nil, nil // unreachable
+}
+
+// ItemToPlain converts an item to plain JSON values. Numbers keep their exact text as json.Number,
+// binary becomes a base64 string and sets become arrays, so the result is easy to read but
+// sets and binary come back as lists and strings when re-imported. Use findPlainLossy to
+// check an item before relying on a round trip.
+func ItemToPlain(item map[string]types.AttributeValue) map[string]any {
+	out := make(map[string]any, len(item))
+	for k, v := range item {
+		out[k] = AttributeToPlain(v)
+	}
+	return out
+}
+
+// AttributeToPlain converts a single attribute value to a plain JSON value.
+func AttributeToPlain(av types.AttributeValue) any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return json.Number(v.Value)
+	case *types.AttributeValueMemberB:
+		return v.Value
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	case *types.AttributeValueMemberSS:
+		return v.Value
+	case *types.AttributeValueMemberNS:
+		ns := make([]json.Number, len(v.Value))
+		for i, n := range v.Value {
+			ns[i] = json.Number(n)
+		}
+		return ns
+	case *types.AttributeValueMemberBS:
+		return v.Value
+	case *types.AttributeValueMemberL:
+		l := make([]any, len(v.Value))
+		for i, e := range v.Value {
+			l[i] = AttributeToPlain(e)
+		}
+		return l
+	case *types.AttributeValueMemberM:
+		return ItemToPlain(v.Value)
+	}
+	return nil
+}
+
+// AttributeFromPlain converts a value decoded with json.Decoder.UseNumber back to an attribute value.
+func AttributeFromPlain(v any) (types.AttributeValue, error) {
+	switch v := v.(type) {
+	case nil:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case string:
+		return &types.AttributeValueMemberS{Value: v}, nil
+	case json.Number:
+		return &types.AttributeValueMemberN{Value: v.String()}, nil
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}, nil
+	case []any:
+		l := make([]types.AttributeValue, len(v))
+		for i, e := range v {
+			av, err := AttributeFromPlain(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = av
+		}
+		return &types.AttributeValueMemberL{Value: l}, nil
+	case map[string]any:
+		m := make(map[string]types.AttributeValue, len(v))
+		for k, e := range v {
+			av, err := AttributeFromPlain(e)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %w", k, err)
+			}
+			m[k] = av
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	}
+	return nil, fmt.Errorf("unsupported JSON value %T", v)
+}
+
+// findPlainLossy returns the path and type of the first attribute, nested ones included, that
+// ItemToPlain cannot convert without losing its type: binary values and sets.
+func findPlainLossy(item map[string]types.AttributeValue) (string, string, bool) {
+	for _, name := range sortedKeys(item) {
+		if path, typ, ok := plainLossy(name, item[name]); ok {
+			return path, typ, true
+		}
+	}
+	return "", "", false
+}
+
+func plainLossy(path string, av types.AttributeValue) (string, string, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB, *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return path, AttributeType(av), true
+	case *types.AttributeValueMemberL:
+		for i, e := range v.Value {
+			if p, typ, ok := plainLossy(fmt.Sprintf("%s[%d]", path, i), e); ok {
+				return p, typ, true
+			}
+		}
+	case *types.AttributeValueMemberM:
+		for _, k := range sortedKeys(v.Value) {
+			if p, typ, ok := plainLossy(path+"."+k, v.Value[k]); ok {
+				return p, typ, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// AttributeType returns the DynamoDB type descriptor of an attribute value (S, N, B, SS, ...).
+func AttributeType(av types.AttributeValue) string {
+	for t := range AttributeToDynamoJSON(av) {
+		return t
+	}
+	return ""
+}
+
+// sortedKeys returns the keys of an item in a stable order for printing.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
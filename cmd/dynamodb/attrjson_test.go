@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var allTypesItem = map[string]types.AttributeValue{
+	"s":    &types.AttributeValueMemberS{Value: "text"},
+	"n":    &types.AttributeValueMemberN{Value: "12345678901234567890.5"},
+	"b":    &types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+	"bool": &types.AttributeValueMemberBOOL{Value: true},
+	"null": &types.AttributeValueMemberNULL{Value: true},
+	"ss":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+	"ns":   &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+	"bs":   &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2, 3}}},
+	"l": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+		&types.AttributeValueMemberS{Value: "x"},
+		&types.AttributeValueMemberN{Value: "1"},
+	}},
+	"m": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"nested": &types.AttributeValueMemberSS{Value: []string{"c"}},
+	}},
+}
+
+func TestDynamoJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(ItemToDynamoJSON(allTypesItem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ItemFromDynamoJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, allTypesItem) {
+		t.Errorf("round trip of %s\ngot  %#v\nwant %#v", data, got, allTypesItem)
+	}
+}
+
+func TestPlainRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		av   types.AttributeValue
+	}{
+		{"string", &types.AttributeValueMemberS{Value: "text"}},
+		{"empty string", &types.AttributeValueMemberS{Value: ""}},
+		{"number", &types.AttributeValueMemberN{Value: "12345678901234567890.5"}},
+		{"bool", &types.AttributeValueMemberBOOL{Value: false}},
+		{"null", &types.AttributeValueMemberNULL{Value: true}},
+		{"list", &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "x"},
+			&types.AttributeValueMemberN{Value: "-1"},
+		}}},
+		{"map", &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"a": &types.AttributeValueMemberBOOL{Value: true},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(AttributeToPlain(tt.av))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			got, err := AttributeFromPlain(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.av) {
+				t.Errorf("round trip of %s: got %#v, want %#v", data, got, tt.av)
+			}
+		})
+	}
+}
+
+func TestFindPlainLossy(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     map[string]types.AttributeValue
+		wantPath string
+		wantType string
+	}{
+		{"scalars", map[string]types.AttributeValue{
+			"s": &types.AttributeValueMemberS{Value: "x"},
+			"n": &types.AttributeValueMemberN{Value: "1"},
+		}, "", ""},
+		{"binary", map[string]types.AttributeValue{"b": &types.AttributeValueMemberB{Value: []byte("x")}}, "b", "B"},
+		{"string set", map[string]types.AttributeValue{"ss": &types.AttributeValueMemberSS{Value: []string{"x"}}}, "ss", "SS"},
+		{"number set", map[string]types.AttributeValue{"ns": &types.AttributeValueMemberNS{Value: []string{"1"}}}, "ns", "NS"},
+		{"binary set", map[string]types.AttributeValue{"bs": &types.AttributeValueMemberBS{Value: [][]byte{{1}}}}, "bs", "BS"},
+		{"in list", map[string]types.AttributeValue{"l": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "x"},
+			&types.AttributeValueMemberB{Value: []byte("x")},
+		}}}, "l[1]", "B"},
+		{"in map", allTypesItem["m"].(*types.AttributeValueMemberM).Value, "nested", "SS"},
+		{"first by name", allTypesItem, "b", "B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, typ, ok := findPlainLossy(tt.item)
+			if ok != (tt.wantPath != "") || path != tt.wantPath || typ != tt.wantType {
+				t.Errorf("findPlainLossy() = %q, %q, %v, want %q, %q", path, typ, ok, tt.wantPath, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	items := []map[string]types.AttributeValue{
+		allTypesItem,
+		{
+			// Same name with another type gets its own column
+			"s": &types.AttributeValueMemberN{Value: "7"},
+			"l": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		},
+		{
+			// Names may contain the colon that separates name and type
+			"a:b":  &types.AttributeValueMemberS{Value: "x"},
+			"a:N":  &types.AttributeValueMemberS{Value: "y"},
+			"url:": &types.AttributeValueMemberN{Value: "1"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, items); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("round trip\ngot  %#v\nwant %#v", got, items)
+	}
+}
+
+func TestFindCSVLossy(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]types.AttributeValue
+		want string
+	}{
+		{"all types", allTypesItem, ""},
+		{"empty string", map[string]types.AttributeValue{
+			"a": &types.AttributeValueMemberS{Value: "x"},
+			"b": &types.AttributeValueMemberS{Value: ""},
+		}, "b"},
+		{"empty binary", map[string]types.AttributeValue{"b": &types.AttributeValueMemberB{Value: []byte{}}}, "b"},
+		{"nested empty string", map[string]types.AttributeValue{"m": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"e": &types.AttributeValueMemberS{Value: ""},
+		}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ok := findCSVLossy(tt.item)
+			if ok != (tt.want != "") || name != tt.want {
+				t.Errorf("findCSVLossy() = %q, %v, want %q", name, ok, tt.want)
+			}
+		})
+	}
+}
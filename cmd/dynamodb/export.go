@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Export/import formats
+const (
+	// FormatDynamoJSON writes one {"Item": {...}} per line in DynamoDB-JSON, like the S3 table export.
+	FormatDynamoJSON = "dynamodb"
+	// FormatJSONLines writes one plain JSON object per line. Tables with binary or set
+	// attributes cannot be exported in it as they would not round-trip.
+	FormatJSONLines = "json"
+	// FormatCSV writes a header of "name:TYPE" columns followed by one row per item. Empty
+	// string and empty binary values cannot be exported in it as empty cells mean absent.
+	FormatCSV = "csv"
+)
+
+// maxBatchWriteItems is the BatchWriteItem limit per request
+const maxBatchWriteItems = 25
+
+// ExportCommand handles `export -table my-table -format dynamodb -file out.jsonl`
+func ExportCommand(svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to export")
+	format := fs.String("format", FormatDynamoJSON, "output format: dynamodb, json or csv")
+	file := fs.String("file", "-", "output file, - for stdout")
+	fs.Parse(args)
+
+	w := io.Writer(os.Stdout)
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := ExportTable(context.TODO(), svc, *table, *format, w)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d items from %s\n", n, *table)
+	return nil
+}
+
+// ImportCommand handles `import -table my-table -format dynamodb -file out.jsonl`
+func ImportCommand(svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to import into")
+	format := fs.String("format", FormatDynamoJSON, "input format: dynamodb, json or csv")
+	file := fs.String("file", "-", "input file, - for stdin")
+	fs.Parse(args)
+
+	r := io.Reader(os.Stdin)
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := ImportTable(context.TODO(), svc, *table, *format, r)
+	if err != nil {
+		return fmt.Errorf("imported %d items before failing: %w", n, err)
+	}
+	log.Printf("Imported %d items into %s\n", n, *table)
+	return nil
+}
+
+// ExportTable scans every page of the table and writes its items to w in the given format.
+func ExportTable(ctx context.Context, svc *dynamodb.Client, table, format string, w io.Writer) (int, error) {
+	var (
+		count int
+		write func(map[string]types.AttributeValue) error
+		flush = func() error { return nil }
+	)
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatDynamoJSON:
+		enc := json.NewEncoder(bw)
+		write = func(item map[string]types.AttributeValue) error {
+			return enc.Encode(map[string]any{"Item": ItemToDynamoJSON(item)})
+		}
+	case FormatJSONLines:
+		enc := json.NewEncoder(bw)
+		write = func(item map[string]types.AttributeValue) error {
+			if path, typ, ok := findPlainLossy(item); ok {
+				return fmt.Errorf("attribute %s of type %s cannot be kept in plain JSON, use -format %s", path, typ, FormatDynamoJSON)
+			}
+			return enc.Encode(ItemToPlain(item))
+		}
+	case FormatCSV:
+		// The header needs every column up front, so rows are collected before writing
+		var items []map[string]types.AttributeValue
+		write = func(item map[string]types.AttributeValue) error {
+			if name, ok := findCSVLossy(item); ok {
+				return fmt.Errorf("attribute %s is empty, which CSV cannot tell from absent, use -format %s", name, FormatDynamoJSON)
+			}
+			items = append(items, item)
+			return nil
+		}
+		flush = func() error { return writeCSV(bw, items) }
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, fmt.Errorf("scan %s: %w", table, err)
+		}
+		for _, item := range page.Items {
+			if err := write(item); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// ImportTable reads items in the given format from r and writes them to the table in batches.
+// It returns the number of items written, also when a batch fails.
+func ImportTable(ctx context.Context, svc *dynamodb.Client, table, format string, r io.Reader) (int, error) {
+	var items []map[string]types.AttributeValue
+
+	switch format {
+	case FormatDynamoJSON:
+		dec := json.NewDecoder(r)
+		for {
+			var line struct {
+				Item map[string]json.RawMessage
+			}
+			if err := dec.Decode(&line); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return 0, err
+			}
+			item, err := ItemFromDynamoJSON(line.Item)
+			if err != nil {
+				return 0, err
+			}
+			items = append(items, item)
+		}
+	case FormatJSONLines:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		for {
+			var line map[string]any
+			if err := dec.Decode(&line); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return 0, err
+			}
+			av, err := AttributeFromPlain(line)
+			if err != nil {
+				return 0, err
+			}
+			items = append(items, av.(*types.AttributeValueMemberM).Value)
+		}
+	case FormatCSV:
+		var err error
+		if items, err = readCSV(r); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	requests := make([]types.WriteRequest, len(items))
+	for i, item := range items {
+		requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+	}
+	return BatchWrite(ctx, svc, table, requests)
+}
+
+// BatchWrite sends the requests in chunks of 25 and retries unprocessed items with backoff.
+// It returns the number of requests written, also when it fails part way.
+func BatchWrite(ctx context.Context, svc *dynamodb.Client, table string, requests []types.WriteRequest) (int, error) {
+	written := 0
+	for start := 0; start < len(requests); start += maxBatchWriteItems {
+		end := min(start+maxBatchWriteItems, len(requests))
+		pending := map[string][]types.WriteRequest{table: requests[start:end]}
+
+		for attempt := 0; len(pending[table]) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > 8 {
+					return written, fmt.Errorf("batch write %s: %d items still unprocessed", table, len(pending[table]))
+				}
+				select {
+				case <-ctx.Done():
+					return written, ctx.Err()
+				case <-time.After(time.Duration(1<<attempt) * 50 * time.Millisecond):
+				}
+			}
+			out, err := svc.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: pending,
+			})
+			if err != nil {
+				return written, fmt.Errorf("batch write %s: %w", table, err)
+			}
+			written += len(pending[table]) - len(out.UnprocessedItems[table])
+			pending = out.UnprocessedItems
+		}
+	}
+	return written, nil
+}
+
+// writeCSV writes a "name:TYPE" header and one row per item. An attribute stored with different
+// types across items gets one column per type so values keep their type on import.
+func writeCSV(w io.Writer, items []map[string]types.AttributeValue) error {
+	seen := map[string]bool{}
+	for _, item := range items {
+		for name, av := range item {
+			seen[name+":"+AttributeType(av)] = true
+		}
+	}
+	columns := sortedKeys(seen)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, item := range items {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			name, typ, _ := splitCSVColumn(col)
+			if av, ok := item[name]; ok && AttributeType(av) == typ {
+				cell, err := encodeCSVCell(av)
+				if err != nil {
+					return fmt.Errorf("column %s: %w", col, err)
+				}
+				row[i] = cell
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readCSV is the reverse of writeCSV. Empty cells are treated as absent attributes.
+func readCSV(r io.Reader) ([]map[string]types.AttributeValue, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	for _, col := range header {
+		if _, _, ok := splitCSVColumn(col); !ok {
+			return nil, fmt.Errorf("column %q has no type, expected name:TYPE", col)
+		}
+	}
+
+	items := make([]map[string]types.AttributeValue, 0, len(rows)-1)
+	for n, row := range rows[1:] {
+		item := map[string]types.AttributeValue{}
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			name, typ, _ := splitCSVColumn(header[i])
+			av, err := decodeCSVCell(typ, cell)
+			if err != nil {
+				return nil, fmt.Errorf("row %d column %s: %w", n+2, header[i], err)
+			}
+			item[name] = av
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// splitCSVColumn splits a "name:TYPE" column at its last colon, as names may contain colons.
+func splitCSVColumn(col string) (name, typ string, ok bool) {
+	i := strings.LastIndex(col, ":")
+	if i < 0 {
+		return col, "", false
+	}
+	return col[:i], col[i+1:], true
+}
+
+// findCSVLossy returns the name of a top-level empty string or binary attribute. Empty cells
+// stand for absent attributes, so these would be lost on import.
+func findCSVLossy(item map[string]types.AttributeValue) (string, bool) {
+	for _, name := range sortedKeys(item) {
+		switch v := item[name].(type) {
+		case *types.AttributeValueMemberS:
+			if v.Value == "" {
+				return name, true
+			}
+		case *types.AttributeValueMemberB:
+			if len(v.Value) == 0 {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// encodeCSVCell writes scalars as text, binary as base64, and sets, lists and maps as JSON.
+func encodeCSVCell(av types.AttributeValue) (string, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value, nil
+	case *types.AttributeValueMemberN:
+		return v.Value, nil
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value), nil
+	case *types.AttributeValueMemberBOOL:
+		return strconv.FormatBool(v.Value), nil
+	case *types.AttributeValueMemberNULL:
+		return "true", nil
+	}
+	data, err := json.Marshal(AttributeToDynamoJSON(av)[AttributeType(av)])
+	return string(data), err
+}
+
+func decodeCSVCell(typ, cell string) (types.AttributeValue, error) {
+	switch typ {
+	case "S":
+		return &types.AttributeValueMemberS{Value: cell}, nil
+	case "N":
+		return &types.AttributeValueMemberN{Value: cell}, nil
+	case "B":
+		b, err := base64.StdEncoding.DecodeString(cell)
+		return &types.AttributeValueMemberB{Value: b}, err
+	case "BOOL":
+		b, err := strconv.ParseBool(cell)
+		return &types.AttributeValueMemberBOOL{Value: b}, err
+	case "NULL":
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	}
+	// Sets, lists and maps are stored as the JSON value of their DynamoDB-JSON form
+	return AttributeFromDynamoJSON(json.RawMessage(fmt.Sprintf(`{%q:%s}`, typ, cell)))
+}
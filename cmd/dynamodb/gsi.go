@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// IndexSpec describes a global secondary index to create.
+type IndexSpec struct {
+	Name          string
+	PartitionKey  string
+	PartitionType types.ScalarAttributeType
+	SortKey       string // optional
+	SortType      types.ScalarAttributeType
+	// Projection defaults to ALL
+	Projection types.ProjectionType
+}
+
+// IndexProgress is reported while waiting for an index.
+type IndexProgress struct {
+	Status      types.IndexStatus
+	Backfilling bool
+	IndexItems  int64
+	TableItems  int64
+}
+
+// Percent is the share of table items already in the index. DescribeTable refreshes item
+// counts only every few hours on AWS, so this is an estimate.
+func (p IndexProgress) Percent() float64 {
+	if p.TableItems == 0 {
+		return 0
+	}
+	return float64(p.IndexItems) * 100 / float64(p.TableItems)
+}
+
+// AddIndex creates a global secondary index on an existing table. Provisioned tables get the
+// same 5/5 throughput as the table created by CreateTable.
+func AddIndex(ctx context.Context, svc *dynamodb.Client, table string, spec IndexSpec) error {
+	desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return err
+	}
+
+	if spec.Projection == "" {
+		spec.Projection = types.ProjectionTypeAll
+	}
+	attrs := []types.AttributeDefinition{{AttributeName: aws.String(spec.PartitionKey), AttributeType: spec.PartitionType}}
+	keys := []types.KeySchemaElement{{AttributeName: aws.String(spec.PartitionKey), KeyType: types.KeyTypeHash}}
+	if spec.SortKey != "" {
+		attrs = append(attrs, types.AttributeDefinition{AttributeName: aws.String(spec.SortKey), AttributeType: spec.SortType})
+		keys = append(keys, types.KeySchemaElement{AttributeName: aws.String(spec.SortKey), KeyType: types.KeyTypeRange})
+	}
+
+	create := &types.CreateGlobalSecondaryIndexAction{
+		IndexName:  aws.String(spec.Name),
+		KeySchema:  keys,
+		Projection: &types.Projection{ProjectionType: spec.Projection},
+	}
+	if bm := desc.Table.BillingModeSummary; bm == nil || bm.BillingMode == types.BillingModeProvisioned {
+		create.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}
+	}
+
+	_, err = svc.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:                   aws.String(table),
+		AttributeDefinitions:        attrs,
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: create}},
+	})
+	if err != nil {
+		return fmt.Errorf("create index %s on %s: %w", spec.Name, table, err)
+	}
+	return nil
+}
+
+// RemoveIndex deletes a global secondary index.
+func RemoveIndex(ctx context.Context, svc *dynamodb.Client, table, index string) error {
+	_, err := svc.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(table),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{Delete: &types.DeleteGlobalSecondaryIndexAction{IndexName: aws.String(index)}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("delete index %s on %s: %w", index, table, err)
+	}
+	return nil
+}
+
+// WaitForIndex polls the table until the index is ACTIVE, or until it is gone when removed is true.
+// progress, if not nil, is called after every poll.
+func WaitForIndex(ctx context.Context, svc *dynamodb.Client, table, index string, removed bool, progress func(IndexProgress)) error {
+	for {
+		desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return err
+		}
+		gsi := findIndex(desc.Table, index)
+
+		switch {
+		case gsi == nil && removed:
+			return nil
+		case gsi == nil:
+			return fmt.Errorf("index %s not found on %s", index, table)
+		}
+
+		p := IndexProgress{
+			Status:      gsi.IndexStatus,
+			Backfilling: aws.ToBool(gsi.Backfilling),
+			IndexItems:  aws.ToInt64(gsi.ItemCount),
+			TableItems:  aws.ToInt64(desc.Table.ItemCount),
+		}
+		if progress != nil {
+			progress(p)
+		}
+		if !removed && p.Status == types.IndexStatusActive && !p.Backfilling {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// Validate checks that the table, or the index named by IndexName, is keyed by PartitionName
+// and SortName, so a query is not sent with the wrong key condition. An empty SortName only
+// checks the partition key, as a query on the partition alone is valid on any key schema.
+func (q KeyQuery) Validate(ctx context.Context, svc *dynamodb.Client) error {
+	desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(q.Table)})
+	if err != nil {
+		return err
+	}
+
+	schema := desc.Table.KeySchema
+	if q.IndexName != "" {
+		if gsi := findIndex(desc.Table, q.IndexName); gsi != nil {
+			schema = gsi.KeySchema
+		} else if lsi := findLocalIndex(desc.Table, q.IndexName); lsi != nil {
+			schema = lsi.KeySchema
+		} else {
+			return fmt.Errorf("index %s not found on %s", q.IndexName, q.Table)
+		}
+	}
+
+	var pk, sk string
+	for _, k := range schema {
+		switch k.KeyType {
+		case types.KeyTypeHash:
+			pk = aws.ToString(k.AttributeName)
+		case types.KeyTypeRange:
+			sk = aws.ToString(k.AttributeName)
+		}
+	}
+	target := q.Table
+	if q.IndexName != "" {
+		target += "/" + q.IndexName
+	}
+	if pk != q.PartitionName {
+		return fmt.Errorf("%s is partitioned by %q, not %q", target, pk, q.PartitionName)
+	}
+	if q.SortName != "" && sk != q.SortName {
+		return fmt.Errorf("%s is sorted by %q, not %q", target, sk, q.SortName)
+	}
+	return nil
+}
+
+// keyAttributeType returns the type of a key attribute from the attribute definitions of the table.
+func keyAttributeType(table *types.TableDescription, name string) (types.ScalarAttributeType, error) {
+	for _, def := range table.AttributeDefinitions {
+		if aws.ToString(def.AttributeName) == name {
+			return def.AttributeType, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no key attribute %q", aws.ToString(table.TableName), name)
+}
+
+func findIndex(table *types.TableDescription, name string) *types.GlobalSecondaryIndexDescription {
+	for i := range table.GlobalSecondaryIndexes {
+		if aws.ToString(table.GlobalSecondaryIndexes[i].IndexName) == name {
+			return &table.GlobalSecondaryIndexes[i]
+		}
+	}
+	return nil
+}
+
+func findLocalIndex(table *types.TableDescription, name string) *types.LocalSecondaryIndexDescription {
+	for i := range table.LocalSecondaryIndexes {
+		if aws.ToString(table.LocalSecondaryIndexes[i].IndexName) == name {
+			return &table.LocalSecondaryIndexes[i]
+		}
+	}
+	return nil
+}
+
+// GSICommand handles `gsi add|remove|list|query`.
+//
+//	gsi add -name by-attribute -pk attribute -sk skey
+//	gsi remove -name by-attribute
+//	gsi list
+//	gsi query -name by-attribute -pk attribute -value my-attribute-value
+//	gsi query -name by-attribute -pk attribute -sk skey -value my-attribute-value -prefix my-sort-key
+//
+// The query -value is sent with the type of the partition key, binary keys take it in base64.
+func GSICommand(svc *dynamodb.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: gsi add|remove|list|query [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("gsi "+action, flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table name")
+	name := fs.String("name", "by-attribute", "index name")
+	pk := fs.String("pk", "attribute", "index partition key")
+	pkType := fs.String("pk-type", "S", "index partition key type: S, N or B")
+	sk := fs.String("sk", "", "index sort key")
+	skType := fs.String("sk-type", "S", "index sort key type: S, N or B")
+	value := fs.String("value", "my-attribute-value", "partition key value, base64 for binary keys (query only)")
+	prefix := fs.String("prefix", "", "sort key prefix, needs -sk (query only)")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	report := func(p IndexProgress) {
+		log.Printf("%s: %s backfilling=%t %d/%d items (%.0f%%)\n", *name, p.Status, p.Backfilling, p.IndexItems, p.TableItems, p.Percent())
+	}
+
+	switch action {
+	case "add":
+		err := AddIndex(ctx, svc, *table, IndexSpec{
+			Name:          *name,
+			PartitionKey:  *pk,
+			PartitionType: types.ScalarAttributeType(*pkType),
+			SortKey:       *sk,
+			SortType:      types.ScalarAttributeType(*skType),
+		})
+		if err != nil {
+			return err
+		}
+		if err := WaitForIndex(ctx, svc, *table, *name, false, report); err != nil {
+			return err
+		}
+		log.Printf("Index %s is active\n", *name)
+	case "remove":
+		if err := RemoveIndex(ctx, svc, *table, *name); err != nil {
+			return err
+		}
+		if err := WaitForIndex(ctx, svc, *table, *name, true, report); err != nil {
+			return err
+		}
+		log.Printf("Index %s removed\n", *name)
+	case "list":
+		desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(*table)})
+		if err != nil {
+			return err
+		}
+		for _, gsi := range desc.Table.GlobalSecondaryIndexes {
+			var keys []string
+			for _, k := range gsi.KeySchema {
+				keys = append(keys, fmt.Sprintf("%s(%s)", aws.ToString(k.AttributeName), k.KeyType))
+			}
+			log.Printf("* %s %v %s items=%d\n", aws.ToString(gsi.IndexName), keys, gsi.IndexStatus, aws.ToInt64(gsi.ItemCount))
+		}
+	case "query":
+		if *prefix != "" && *sk == "" {
+			return errors.New("gsi query -prefix needs -sk")
+		}
+		q := KeyQuery{Table: *table, IndexName: *name, PartitionName: *pk, SortName: *sk}
+		if err := q.Validate(ctx, svc); err != nil {
+			return err
+		}
+		desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(*table)})
+		if err != nil {
+			return err
+		}
+		typ, err := keyAttributeType(desc.Table, *pk)
+		if err != nil {
+			return err
+		}
+		pkValue, err := decodeCSVCell(string(typ), *value)
+		if err != nil {
+			return fmt.Errorf("-value for %s key %s: %w", typ, *pk, err)
+		}
+		input := q.Equals(*value)
+		if *prefix != "" {
+			input = q.BeginsWith(*value, *prefix)
+		}
+		// KeyQuery sends string keys, the index may be keyed by a number or binary
+		input.ExpressionAttributeValues[":pk"] = pkValue
+		items, err := QueryAll(ctx, svc, input)
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			fmt.Printf("Item(%d): %v\n", i, ItemToPlain(item))
+		}
+	default:
+		return fmt.Errorf("unknown gsi action %q", action)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Composite keys are written as ENTITY#segment#segment. Every byte of the entity or of a string
+// segment up to '$' is escaped as '$' and two hex digits, e.g. "a#b" as "a$23b". The separator
+// then sorts below every byte of an encoded segment, so a shorter segment sorts before longer
+// ones sharing its prefix, and escaped bytes still sort below all unescaped ones.
+const (
+	keySeparator = '#'
+	keyEscape    = '$'
+)
+
+// keyTimeLayout has a fixed width so encoded times sort in chronological order
+const keyTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// EntityType is the typed prefix of a single-table key, e.g. "CUSTOMER" or "ORDER".
+type EntityType string
+
+// Key starts a composite key for the entity.
+func (e EntityType) Key() *KeyBuilder {
+	return &KeyBuilder{entity: escapeKeySegment(string(e))}
+}
+
+// Is reports whether the encoded key belongs to the entity.
+func (e EntityType) Is(key string) bool {
+	entity := escapeKeySegment(string(e))
+	return key == entity || strings.HasPrefix(key, entity+string(keySeparator))
+}
+
+// KeyBuilder appends encoded segments to an entity prefix.
+type KeyBuilder struct {
+	entity string
+	parts  []string
+}
+
+// Str appends an escaped string segment.
+func (k *KeyBuilder) Str(s string) *KeyBuilder {
+	k.parts = append(k.parts, escapeKeySegment(s))
+	return k
+}
+
+func escapeKeySegment(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= keyEscape {
+			fmt.Fprintf(&b, "%c%02X", keyEscape, c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeKeySegment(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != keyEscape {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("segment %q ends inside an escape", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil || c > keyEscape {
+			return "", fmt.Errorf("segment %q has an invalid escape %q", s, s[i:i+3])
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// Int appends a zero-padded number segment. Negative numbers are offset so that every
+// int64 encodes to 20 digits and the string order matches the numeric order.
+func (k *KeyBuilder) Int(n int64) *KeyBuilder {
+	return k.Uint(uint64(n) ^ (1 << 63))
+}
+
+// Uint appends a zero-padded 20 digit number segment.
+func (k *KeyBuilder) Uint(n uint64) *KeyBuilder {
+	k.parts = append(k.parts, fmt.Sprintf("%020d", n))
+	return k
+}
+
+// Time appends a fixed-width UTC timestamp segment.
+func (k *KeyBuilder) Time(t time.Time) *KeyBuilder {
+	k.parts = append(k.parts, t.UTC().Format(keyTimeLayout))
+	return k
+}
+
+// String returns the encoded key.
+func (k *KeyBuilder) String() string {
+	if len(k.parts) == 0 {
+		return k.entity
+	}
+	return k.entity + string(keySeparator) + strings.Join(k.parts, string(keySeparator))
+}
+
+// Prefix returns the encoded key followed by a separator, for begins_with queries that must
+// match whole segments only (ORDER#1 must not match ORDER#12).
+func (k *KeyBuilder) Prefix() string {
+	return k.String() + string(keySeparator)
+}
+
+// End returns an upper bound above every key that extends this one, to be used as the
+// inclusive end of a Between query: Between(pk, from.String(), to.End()).
+func (k *KeyBuilder) End() string {
+	return k.Prefix() + string(utf8.MaxRune)
+}
+
+// ParsedKey is a decoded composite key.
+type ParsedKey struct {
+	Entity   EntityType
+	Segments []string
+}
+
+// ParseKey splits an encoded key into its entity and unescaped segments.
+func ParseKey(key string) (ParsedKey, error) {
+	parts := strings.Split(key, string(keySeparator))
+	for i, part := range parts {
+		var err error
+		if parts[i], err = unescapeKeySegment(part); err != nil {
+			return ParsedKey{}, fmt.Errorf("key %q: %w", key, err)
+		}
+	}
+	return ParsedKey{Entity: EntityType(parts[0]), Segments: parts[1:]}, nil
+}
+
+// Int decodes segment i written with KeyBuilder.Int.
+func (p ParsedKey) Int(i int) (int64, error) {
+	n, err := p.Uint(i)
+	return int64(n ^ (1 << 63)), err
+}
+
+// Uint decodes segment i written with KeyBuilder.Uint.
+func (p ParsedKey) Uint(i int) (uint64, error) {
+	if i >= len(p.Segments) {
+		return 0, fmt.Errorf("key has %d segments, no segment %d", len(p.Segments), i)
+	}
+	return strconv.ParseUint(p.Segments[i], 10, 64)
+}
+
+// Time decodes segment i written with KeyBuilder.Time.
+func (p ParsedKey) Time(i int) (time.Time, error) {
+	if i >= len(p.Segments) {
+		return time.Time{}, fmt.Errorf("key has %d segments, no segment %d", len(p.Segments), i)
+	}
+	return time.Parse(keyTimeLayout, p.Segments[i])
+}
+
+// KeyQuery describes the key attributes of a table, or of one of its indexes, for range
+// queries on encoded keys.
+type KeyQuery struct {
+	Table string
+	// IndexName targets a secondary index instead of the table when set
+	IndexName     string
+	PartitionName string
+	SortName      string
+}
+
+// Equals returns a query for all items of a partition.
+func (q KeyQuery) Equals(partition string) *dynamodb.QueryInput {
+	return q.input("#pk = :pk", false, map[string]types.AttributeValue{
+		":pk": &types.AttributeValueMemberS{Value: partition},
+	})
+}
+
+// BeginsWith returns a query for the items of a partition whose sort key starts with prefix.
+func (q KeyQuery) BeginsWith(partition, prefix string) *dynamodb.QueryInput {
+	return q.input("#pk = :pk AND begins_with(#sk, :prefix)", true, map[string]types.AttributeValue{
+		":pk":     &types.AttributeValueMemberS{Value: partition},
+		":prefix": &types.AttributeValueMemberS{Value: prefix},
+	})
+}
+
+// Between returns a query for the items of a partition whose sort key is in [from, to].
+func (q KeyQuery) Between(partition, from, to string) *dynamodb.QueryInput {
+	return q.input("#pk = :pk AND #sk BETWEEN :from AND :to", true, map[string]types.AttributeValue{
+		":pk":   &types.AttributeValueMemberS{Value: partition},
+		":from": &types.AttributeValueMemberS{Value: from},
+		":to":   &types.AttributeValueMemberS{Value: to},
+	})
+}
+
+func (q KeyQuery) input(condition string, withSortKey bool, values map[string]types.AttributeValue) *dynamodb.QueryInput {
+	// DynamoDB rejects expression names that the condition does not use
+	names := map[string]string{"#pk": q.PartitionName}
+	if withSortKey {
+		names["#sk"] = q.SortName
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(q.Table),
+		KeyConditionExpression:    aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+	if q.IndexName != "" {
+		input.IndexName = aws.String(q.IndexName)
+	}
+	return input
+}
+
+// QueryAll runs the query and returns the items of every page.
+func QueryAll(ctx context.Context, svc *dynamodb.Client, input *dynamodb.QueryInput) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// Entity prefixes used by the keys command
+const (
+	EntityCustomer EntityType = "CUSTOMER"
+	EntityOrder    EntityType = "ORDER"
+)
+
+// KeysCommand handles `keys -customer acme#1`. It writes a few orders of a customer with
+// composite keys and reads them back with begins_with and between queries.
+func KeysCommand(svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to write to")
+	customer := fs.String("customer", "acme#1", "customer id, may contain separators")
+	fs.Parse(args)
+
+	ctx := context.TODO()
+	pk := EntityCustomer.Key().Str(*customer).String()
+	now := time.Now()
+
+	var requests []types.WriteRequest
+	for _, n := range []int64{7, 42, 1000, -3} {
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{
+			DBPRIMARY_KEY: &types.AttributeValueMemberS{Value: pk},
+			DBSORT_KEY:    &types.AttributeValueMemberS{Value: EntityOrder.Key().Int(n).Time(now).String()},
+			"attribute":   &types.AttributeValueMemberS{Value: fmt.Sprintf("order %d", n)},
+		}}})
+	}
+	if _, err := BatchWrite(ctx, svc, *table, requests); err != nil {
+		return err
+	}
+
+	q := KeyQuery{Table: *table, PartitionName: DBPRIMARY_KEY, SortName: DBSORT_KEY}
+	queries := []struct {
+		name  string
+		input *dynamodb.QueryInput
+	}{
+		{"all orders", q.BeginsWith(pk, EntityOrder.Key().Prefix())},
+		{"orders 0..100", q.Between(pk, EntityOrder.Key().Int(0).String(), EntityOrder.Key().Int(100).End())},
+		{"order 42", q.BeginsWith(pk, EntityOrder.Key().Int(42).Prefix())},
+		{"orders below 0", q.Between(pk, EntityOrder.Key().Int(math.MinInt64).String(), EntityOrder.Key().Int(-1).End())},
+	}
+	for _, query := range queries {
+		items, err := QueryAll(ctx, svc, query.input)
+		if err != nil {
+			return fmt.Errorf("%s: %w", query.name, err)
+		}
+		log.Printf("%s:\n", query.name)
+		for _, item := range items {
+			sk, _ := item[DBSORT_KEY].(*types.AttributeValueMemberS)
+			if sk == nil {
+				return errors.New("item without a string sort key")
+			}
+			parsed, err := ParseKey(sk.Value)
+			if err != nil {
+				return err
+			}
+			n, _ := parsed.Int(0)
+			at, _ := parsed.Time(1)
+			log.Printf("  %s %d at %s\n", parsed.Entity, n, at.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
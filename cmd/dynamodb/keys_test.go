@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKeyBuilderString(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name string
+		key  *KeyBuilder
+		want string
+	}{
+		{"entity only", EntityType("CUSTOMER").Key(), "CUSTOMER"},
+		{"string", EntityType("CUSTOMER").Key().Str("alice"), "CUSTOMER#alice"},
+		{"escaped separator", EntityType("CUSTOMER").Key().Str("a#b"), "CUSTOMER#a$23b"},
+		{"escaped escape", EntityType("CUSTOMER").Key().Str("a$b"), "CUSTOMER#a$24b"},
+		{"escaped space", EntityType("CUSTOMER").Key().Str("a b!"), "CUSTOMER#a$20b$21"},
+		{"backslash", EntityType("CUSTOMER").Key().Str(`a\b`), `CUSTOMER#a\b`},
+		{"escaped entity", EntityType("A#B").Key().Str("c"), "A$23B#c"},
+		{"empty string", EntityType("CUSTOMER").Key().Str("").Str("x"), "CUSTOMER##x"},
+		{"zero", EntityType("ORDER").Key().Int(0), "ORDER#09223372036854775808"},
+		{"negative", EntityType("ORDER").Key().Int(-1), "ORDER#09223372036854775807"},
+		{"uint", EntityType("ORDER").Key().Uint(42), "ORDER#00000000000000000042"},
+		{"time in UTC", EntityType("ORDER").Key().Time(at), "ORDER#2024-01-02T02:04:05.000000006Z"},
+		{"segments", EntityType("ORDER").Key().Str("alice").Int(1), "ORDER#alice#09223372036854775809"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyBuilderIntOrder(t *testing.T) {
+	numbers := []int64{math.MinInt64, -1000, -10, -2, -1, 0, 1, 2, 9, 10, 100, math.MaxInt64}
+	keys := make([]string, len(numbers))
+	for i, n := range numbers {
+		keys[i] = EntityType("N").Key().Int(n).String()
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("keys of ascending numbers are not sorted: %q", keys)
+	}
+	for _, k := range keys {
+		if len(k) != len(keys[0]) {
+			t.Errorf("key %q has length %d, want %d", k, len(k), len(keys[0]))
+		}
+	}
+}
+
+func TestKeyBuilderTimeOrder(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Without a fixed width, .1s would format shorter than .123s and sort after it
+	times := []time.Time{
+		base,
+		base.Add(100 * time.Millisecond),
+		base.Add(123 * time.Millisecond),
+		base.Add(time.Second),
+		base.Add(time.Second + time.Nanosecond),
+		base.AddDate(1, 0, 0),
+	}
+	keys := make([]string, len(times))
+	for i, at := range times {
+		keys[i] = EntityType("T").Key().Time(at).String()
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("keys of ascending times are not sorted: %q", keys)
+	}
+}
+
+func TestKeyBuilderStrOrder(t *testing.T) {
+	// A shorter segment must sort before longer ones sharing its prefix, even across separators
+	// and with bytes that sort below the separator
+	keys := []string{
+		EntityType("C").Key().Str("a").Str("z").String(),
+		EntityType("C").Key().Str("a\x00").String(),
+		EntityType("C").Key().Str("a ").String(),
+		EntityType("C").Key().Str("a!").String(),
+		EntityType("C").Key().Str("a\"").String(),
+		EntityType("C").Key().Str("a#").String(),
+		EntityType("C").Key().Str("a$").String(),
+		EntityType("C").Key().Str("a%").String(),
+		EntityType("C").Key().Str("aA").String(),
+		EntityType("C").Key().Str("ab").String(),
+		EntityType("C").Key().Str("aé").String(),
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("keys are not sorted: %q", keys)
+	}
+}
+
+func TestKeyBuilderPrefix(t *testing.T) {
+	prefix := EntityType("ORDER").Key().Str("1").Prefix()
+	if got := EntityType("ORDER").Key().Str("12").String(); len(got) >= len(prefix) && got[:len(prefix)] == prefix {
+		t.Errorf("prefix %q matches %q", prefix, got)
+	}
+	from := EntityType("ORDER").Key().Str("a")
+	child := EntityType("ORDER").Key().Str("a").Int(math.MaxInt64).String()
+	if !(from.String() < child && child < from.End()) {
+		t.Errorf("%q is not between %q and %q", child, from.String(), from.End())
+	}
+}
+
+func TestParseKeyRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	tests := []struct {
+		name     string
+		key      *KeyBuilder
+		segments []string
+	}{
+		{"entity only", EntityType("CUSTOMER").Key(), []string{}},
+		{"strings", EntityType("CUSTOMER").Key().Str("a#b").Str(`c\d`).Str(""), []string{"a#b", `c\d`, ""}},
+		{"escapes", EntityType("CUSTOMER").Key().Str("$23").Str(" !\"\x00"), []string{"$23", " !\"\x00"}},
+		{"trailing escape", EntityType("CUSTOMER").Key().Str("x$"), []string{"x$"}},
+		{"unicode", EntityType("CUSTOMER").Key().Str("héllo#wörld"), []string{"héllo#wörld"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseKey(tt.key.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Entity != EntityType("CUSTOMER") {
+				t.Errorf("entity = %q, want CUSTOMER", p.Entity)
+			}
+			if !reflect.DeepEqual(p.Segments, tt.segments) {
+				t.Errorf("segments = %q, want %q", p.Segments, tt.segments)
+			}
+		})
+	}
+
+	t.Run("typed segments", func(t *testing.T) {
+		for _, n := range []int64{math.MinInt64, -1, 0, 1, math.MaxInt64} {
+			p, err := ParseKey(EntityType("ORDER").Key().Int(n).Uint(uint64(math.MaxUint64)).Time(at).String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := p.Int(0); err != nil || got != n {
+				t.Errorf("Int(0) = %d, %v, want %d", got, err, n)
+			}
+			if got, err := p.Uint(1); err != nil || got != math.MaxUint64 {
+				t.Errorf("Uint(1) = %d, %v, want %d", got, err, uint64(math.MaxUint64))
+			}
+			if got, err := p.Time(2); err != nil || !got.Equal(at) {
+				t.Errorf("Time(2) = %v, %v, want %v", got, err, at)
+			}
+			if _, err := p.Int(3); err == nil {
+				t.Error("Int(3) of a key with 3 segments succeeded")
+			}
+		}
+	})
+
+	t.Run("entity with separator", func(t *testing.T) {
+		p, err := ParseKey(EntityType("A#B").Key().Str("c").String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Entity != "A#B" || !reflect.DeepEqual(p.Segments, []string{"c"}) {
+			t.Errorf("ParseKey() = %q, %q, want A#B, [c]", p.Entity, p.Segments)
+		}
+	})
+
+	t.Run("invalid escapes", func(t *testing.T) {
+		for _, key := range []string{"CUSTOMER#a$", "CUSTOMER#a$2", "CUSTOMER#a$zz", "CUSTOMER#a$41"} {
+			if _, err := ParseKey(key); err == nil {
+				t.Errorf("ParseKey(%q) succeeded", key)
+			}
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// VersionAttribute is the attribute holding the version number of locked items
+const VersionAttribute = "version"
+
+// ErrVersionConflict is matched by every *ConflictError.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrItemExists is returned by CreateItem when an item with the same key is already stored.
+var ErrItemExists = errors.New("item already exists")
+
+// ConflictError is returned when the stored version no longer matches the expected one.
+type ConflictError struct {
+	Table    string
+	Expected int64
+	// Current is the item as stored when the write was rejected, nil if it was deleted
+	Current map[string]types.AttributeValue
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %v, expected version %d but found %d", e.Table, ErrVersionConflict, e.Expected, ItemVersion(e.Current))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// ItemVersion returns the version of an item, 0 if it has none.
+func ItemVersion(item map[string]types.AttributeValue) int64 {
+	n, ok := item[VersionAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	v, _ := strconv.ParseInt(n.Value, 10, 64)
+	return v
+}
+
+// CreateItem puts the item only if no item with the same full primary key exists, and
+// sets its version to 1. The condition is evaluated against the item with the item's
+// partition and sort key, so other items of the same partition do not conflict.
+func CreateItem(ctx context.Context, svc *dynamodb.Client, table, partitionName string, item map[string]types.AttributeValue) error {
+	item = withVersion(item, 1)
+	_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(table),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+		ExpressionAttributeNames: map[string]string{"#pk": partitionName},
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return fmt.Errorf("%s: %w", table, ErrItemExists)
+	}
+	return err
+}
+
+// PutVersioned replaces the item if its stored version still equals the item's version,
+// and stores it with the version incremented. An item without a version is only written
+// if the stored item has no version either. It returns the new version.
+func PutVersioned(ctx context.Context, svc *dynamodb.Client, table string, item map[string]types.AttributeValue) (int64, error) {
+	expected := ItemVersion(item)
+	input := &dynamodb.PutItemInput{
+		TableName:                           aws.String(table),
+		Item:                                withVersion(item, expected+1),
+		ExpressionAttributeNames:            map[string]string{"#v": VersionAttribute},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if expected == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(#v)")
+	} else {
+		input.ConditionExpression = aws.String("#v = :expected")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(expected, 10)},
+		}
+	}
+
+	_, err := svc.PutItem(ctx, input)
+	if err != nil {
+		return 0, conflictError(table, expected, err)
+	}
+	return expected + 1, nil
+}
+
+// UpdateVersioned applies the update expression if the stored version equals expected and
+// increments the version in the same write. Like PutVersioned, an expected version of 0 only
+// updates an item without a version, which then gets version 1. The expression may have any
+// of the SET, REMOVE, ADD and DELETE clauses, and must not use the names #v, :expected or :one.
+func UpdateVersioned(ctx context.Context, svc *dynamodb.Client, table string, key map[string]types.AttributeValue, expected int64, update string, names map[string]string, values map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	allNames := map[string]string{"#v": VersionAttribute}
+	for k, v := range names {
+		allNames[k] = v
+	}
+	allValues := map[string]types.AttributeValue{
+		":one": &types.AttributeValueMemberN{Value: "1"},
+	}
+	for k, v := range values {
+		allValues[k] = v
+	}
+	condition, bump := "attribute_not_exists(#v)", "#v = :one"
+	if expected != 0 {
+		condition, bump = "#v = :expected", "#v = #v + :one"
+		allValues[":expected"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expected, 10)}
+	}
+	update, err := addToSetClause(update, bump)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(table),
+		Key:                                 key,
+		UpdateExpression:                    aws.String(update),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            allNames,
+		ExpressionAttributeValues:           allValues,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return nil, conflictError(table, expected, err)
+	}
+	return out.Attributes, nil
+}
+
+// updateClauses are the clause keywords of an update expression
+var updateClauses = []string{"SET", "REMOVE", "ADD", "DELETE"}
+
+// addToSetClause adds an action to the SET clause of an update expression, or adds a SET
+// clause if it has none, e.g. "REMOVE a" becomes "SET action REMOVE a". Names and values are
+// placeholders in expressions, so the clause keywords are the only words that match them.
+func addToSetClause(update, action string) (string, error) {
+	var (
+		clauses []string
+		bodies  = map[string][]string{}
+		current string
+	)
+	for _, word := range strings.Fields(update) {
+		if keyword := strings.ToUpper(word); slices.Contains(updateClauses, keyword) {
+			if _, ok := bodies[keyword]; ok {
+				return "", fmt.Errorf("update expression %q has more than one %s clause", update, keyword)
+			}
+			clauses = append(clauses, keyword)
+			bodies[keyword] = nil
+			current = keyword
+			continue
+		}
+		if current == "" {
+			return "", fmt.Errorf("update expression %q does not start with %v", update, updateClauses)
+		}
+		bodies[current] = append(bodies[current], word)
+	}
+
+	if !slices.Contains(clauses, "SET") {
+		clauses = append([]string{"SET"}, clauses...)
+	}
+	parts := make([]string, 0, len(clauses))
+	for _, keyword := range clauses {
+		body := strings.Join(bodies[keyword], " ")
+		if keyword == "SET" {
+			body = strings.TrimPrefix(body+", "+action, ", ")
+		}
+		parts = append(parts, keyword+" "+body)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// MergeFunc receives the current item (nil if it does not exist) and returns the item to write.
+type MergeFunc func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+
+// RetryOnConflict reads the item, merges it and writes it with PutVersioned. On a version
+// conflict it merges again against the item returned by the failed write, up to attempts times.
+func RetryOnConflict(ctx context.Context, svc *dynamodb.Client, table string, key map[string]types.AttributeValue, attempts int, merge MergeFunc) (map[string]types.AttributeValue, error) {
+	out, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	current := out.Item
+
+	for attempt := 1; ; attempt++ {
+		next, err := merge(current)
+		if err != nil {
+			return nil, err
+		}
+		next = withVersion(next, ItemVersion(current))
+
+		version, err := PutVersioned(ctx, svc, table, next)
+		if err == nil {
+			return withVersion(next, version), nil
+		}
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) || attempt >= attempts {
+			return nil, err
+		}
+		current = conflict.Current
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 20 * time.Millisecond):
+		}
+	}
+}
+
+func conflictError(table string, expected int64, err error) error {
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return &ConflictError{Table: table, Expected: expected, Current: ccf.Item}
+	}
+	return err
+}
+
+// withVersion returns a copy of the item with the version attribute set, or removed for 0.
+func withVersion(item map[string]types.AttributeValue, version int64) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item)+1)
+	for k, v := range item {
+		out[k] = v
+	}
+	if version == 0 {
+		delete(out, VersionAttribute)
+	} else {
+		out[VersionAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+	}
+	return out
+}
+
+// LockCommand handles `lock -writers 5 -increments 10`. Concurrent writers increment the same
+// counter with RetryOnConflict, and the final count shows that no update was lost.
+func LockCommand(svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("lock", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to write to")
+	writers := fs.Int("writers", 5, "number of concurrent writers")
+	increments := fs.Int("increments", 10, "increments per writer")
+	fs.Parse(args)
+
+	ctx := context.TODO()
+	key := map[string]types.AttributeValue{
+		DBPRIMARY_KEY: &types.AttributeValueMemberS{Value: "my-partition-key"},
+		DBSORT_KEY:    &types.AttributeValueMemberS{Value: "locked-counter-" + time.Now().Format(time.RFC3339Nano)},
+	}
+	if err := CreateItem(ctx, svc, *table, DBPRIMARY_KEY, withCount(key, 0)); err != nil && !errors.Is(err, ErrItemExists) {
+		return err
+	}
+
+	errs := make(chan error, *writers)
+	for w := 0; w < *writers; w++ {
+		go func() {
+			for i := 0; i < *increments; i++ {
+				_, err := RetryOnConflict(ctx, svc, *table, key, 50, func(current map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+					n, _ := current["count"].(*types.AttributeValueMemberN)
+					if n == nil {
+						return nil, errors.New("counter item is missing")
+					}
+					count, err := strconv.Atoi(n.Value)
+					return withCount(current, count+1), err
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < *writers; w++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+
+	out, err := svc.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(*table), Key: key, ConsistentRead: aws.Bool(true)})
+	if err != nil {
+		return err
+	}
+	n, ok := out.Item["count"].(*types.AttributeValueMemberN)
+	if !ok {
+		return fmt.Errorf("counter item in %s has no numeric count", *table)
+	}
+	log.Printf("Counter: %s, version %d, expected %d\n", n.Value, ItemVersion(out.Item), *writers**increments)
+	return nil
+}
+
+func withCount(item map[string]types.AttributeValue, count int) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item)+1)
+	for k, v := range item {
+		out[k] = v
+	}
+	out["count"] = &types.AttributeValueMemberN{Value: strconv.Itoa(count)}
+	return out
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestAddToSetClause(t *testing.T) {
+	const bump = "#v = #v + :one"
+	tests := []struct {
+		name   string
+		update string
+		want   string
+	}{
+		{"empty", "", "SET #v = #v + :one"},
+		{"set", "SET #a = :a", "SET #a = :a, #v = #v + :one"},
+		{"lower case set", "set #a = :a, #b = :b", "SET #a = :a, #b = :b, #v = #v + :one"},
+		{"remove only", "REMOVE #a, #b", "SET #v = #v + :one REMOVE #a, #b"},
+		{"add only", "ADD #n :n", "SET #v = #v + :one ADD #n :n"},
+		{"delete only", "DELETE #s :s", "SET #v = #v + :one DELETE #s :s"},
+		{"set then remove", "SET #a = :a REMOVE #b", "SET #a = :a, #v = #v + :one REMOVE #b"},
+		{"remove then set", "REMOVE #b SET #a = :a", "REMOVE #b SET #a = :a, #v = #v + :one"},
+		{"all clauses", "ADD #n :n SET #a = :a DELETE #s :s REMOVE #b", "ADD #n :n SET #a = :a, #v = #v + :one DELETE #s :s REMOVE #b"},
+		{"functions", "SET #l = list_append(#l, :l), #c = if_not_exists(#c, :z) REMOVE #x", "SET #l = list_append(#l, :l), #c = if_not_exists(#c, :z), #v = #v + :one REMOVE #x"},
+		{"extra whitespace", "  SET\t#a = :a\n REMOVE  #b ", "SET #a = :a, #v = #v + :one REMOVE #b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addToSetClause(tt.update, bump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("addToSetClause(%q) = %q, want %q", tt.update, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddToSetClauseErrors(t *testing.T) {
+	for _, update := range []string{"#a = :a", "SET #a = :a SET #b = :b", "REMOVE #a remove #b"} {
+		if got, err := addToSetClause(update, "#v = :one"); err == nil {
+			t.Errorf("addToSetClause(%q) = %q, want an error", update, got)
+		}
+	}
+}
@@ -65,6 +65,12 @@ func main() {
 	// Create DynamoDB service client
 	svc := dynamodb.NewFromConfig(provider)
 
+	// Run a sub-command when one is given, e.g. `go run ./cmd/dynamodb export -format csv`
+	if len(os.Args) > 1 {
+		RunCommand(provider, svc, os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Create a new table
 	CreateTable(svc)
 
@@ -78,6 +84,37 @@ func main() {
 	Query(svc)
 }
 
+func RunCommand(provider aws.Config, svc *dynamodb.Client, name string, args []string) {
+	var err error
+	switch name {
+	case "export":
+		err = ExportCommand(svc, args)
+	case "import":
+		err = ImportCommand(svc, args)
+	case "transact":
+		err = TransactCommand(svc, args)
+	case "stream":
+		err = StreamCommand(provider, svc, args)
+	case "keys":
+		err = KeysCommand(svc, args)
+	case "lock":
+		err = LockCommand(svc, args)
+	case "ttl":
+		err = TTLCommand(svc, args)
+	case "gsi":
+		err = GSICommand(svc, args)
+	case "migrate":
+		err = MigrateCommand(svc, args)
+	case "partiql":
+		err = PartiQLCommand(svc, args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
+
 func CreateTable(svc *dynamodb.Client) {
 
 	// Check if table exists
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gopkg.in/yaml.v3"
+)
+
+// MIGRATIONS_TABLE records the applied migration versions
+var MIGRATIONS_TABLE = "schema_migrations"
+
+// Migration is one versioned schema change. Versions are applied in ascending order and
+// reverted in descending order.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, svc *dynamodb.Client) error
+	Down        func(ctx context.Context, svc *dynamodb.Client) error
+}
+
+// AppliedMigration is a row of the migrations table.
+type AppliedMigration struct {
+	Version     int       `dynamodbav:"version"`
+	Description string    `dynamodbav:"description"`
+	AppliedAt   time.Time `dynamodbav:"appliedAt"`
+}
+
+// TableSpec describes a table to create.
+type TableSpec struct {
+	Name         string        `yaml:"name"`
+	PartitionKey KeySpec       `yaml:"partitionKey"`
+	SortKey      *KeySpec      `yaml:"sortKey"`
+	Indexes      []IndexConfig `yaml:"indexes"`
+	// OnDemand uses PAY_PER_REQUEST billing instead of 5/5 provisioned throughput
+	OnDemand bool `yaml:"onDemand"`
+}
+
+// KeySpec is a key attribute and its scalar type (S, N or B).
+type KeySpec struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+// IndexConfig is the YAML form of an IndexSpec.
+type IndexConfig struct {
+	Table        string   `yaml:"table"`
+	Name         string   `yaml:"name"`
+	PartitionKey KeySpec  `yaml:"partitionKey"`
+	SortKey      *KeySpec `yaml:"sortKey"`
+	Projection   string   `yaml:"projection"`
+}
+
+func (c IndexConfig) spec() IndexSpec {
+	s := IndexSpec{
+		Name:          c.Name,
+		PartitionKey:  c.PartitionKey.Name,
+		PartitionType: types.ScalarAttributeType(c.PartitionKey.Type),
+		Projection:    types.ProjectionType(c.Projection),
+	}
+	if c.SortKey != nil {
+		s.SortKey = c.SortKey.Name
+		s.SortType = types.ScalarAttributeType(c.SortKey.Type)
+	}
+	return s
+}
+
+// CreateTableFromSpec creates the table with its indexes and waits until it is ACTIVE.
+// An existing table is left as it is.
+func CreateTableFromSpec(ctx context.Context, svc *dynamodb.Client, spec TableSpec) error {
+	attrs := map[string]string{spec.PartitionKey.Name: spec.PartitionKey.Type}
+	keys := []types.KeySchemaElement{{AttributeName: aws.String(spec.PartitionKey.Name), KeyType: types.KeyTypeHash}}
+	if spec.SortKey != nil {
+		attrs[spec.SortKey.Name] = spec.SortKey.Type
+		keys = append(keys, types.KeySchemaElement{AttributeName: aws.String(spec.SortKey.Name), KeyType: types.KeyTypeRange})
+	}
+
+	throughput := &types.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(5), WriteCapacityUnits: aws.Int64(5)}
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(spec.Name),
+		KeySchema:   keys,
+		BillingMode: types.BillingModeProvisioned,
+	}
+	if spec.OnDemand {
+		input.BillingMode = types.BillingModePayPerRequest
+		throughput = nil
+	}
+	input.ProvisionedThroughput = throughput
+
+	for _, idx := range spec.Indexes {
+		s := idx.spec()
+		attrs[s.PartitionKey] = string(s.PartitionType)
+		idxKeys := []types.KeySchemaElement{{AttributeName: aws.String(s.PartitionKey), KeyType: types.KeyTypeHash}}
+		if s.SortKey != "" {
+			attrs[s.SortKey] = string(s.SortType)
+			idxKeys = append(idxKeys, types.KeySchemaElement{AttributeName: aws.String(s.SortKey), KeyType: types.KeyTypeRange})
+		}
+		if s.Projection == "" {
+			s.Projection = types.ProjectionTypeAll
+		}
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName:             aws.String(s.Name),
+			KeySchema:             idxKeys,
+			Projection:            &types.Projection{ProjectionType: s.Projection},
+			ProvisionedThroughput: throughput,
+		})
+	}
+	for _, name := range sortedKeys(attrs) {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: types.ScalarAttributeType(attrs[name]),
+		})
+	}
+
+	_, err := svc.CreateTable(ctx, input)
+	var inUse *types.ResourceInUseException
+	if errors.As(err, &inUse) {
+		log.Printf("Table %s already exists\n", spec.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create table %s: %w", spec.Name, err)
+	}
+	return dynamodb.NewTableExistsWaiter(svc).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(spec.Name)}, 2*time.Minute)
+}
+
+// DeleteTable deletes the table and waits until it is gone. A missing table is not an error.
+func DeleteTable(ctx context.Context, svc *dynamodb.Client, table string) error {
+	_, err := svc.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("delete table %s: %w", table, err)
+	}
+	return dynamodb.NewTableNotExistsWaiter(svc).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, 2*time.Minute)
+}
+
+// TransformItems scans the table and rewrites every item through fn. fn returns the new item,
+// or nil to delete the item. Nothing is written if fn changes or removes a key attribute of
+// any item, as the put would create a new item and leave the old one in place.
+func TransformItems(ctx context.Context, svc *dynamodb.Client, table string, fn func(map[string]types.AttributeValue) (map[string]types.AttributeValue, error)) (int, error) {
+	keyNames, err := tableKeyNames(ctx, svc, table)
+	if err != nil {
+		return 0, err
+	}
+
+	var requests []types.WriteRequest
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{TableName: aws.String(table)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("scan %s: %w", table, err)
+		}
+		for _, item := range page.Items {
+			// Copy the key first, fn may modify the item in place
+			key := map[string]types.AttributeValue{}
+			for _, k := range keyNames {
+				key[k] = item[k]
+			}
+			next, err := fn(item)
+			if err != nil {
+				return 0, err
+			}
+			if next == nil {
+				requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+				continue
+			}
+			for _, k := range keyNames {
+				if !reflect.DeepEqual(next[k], key[k]) {
+					return 0, fmt.Errorf("transform of %s changes key attribute %s of item %v", table, k, ItemToPlain(key))
+				}
+			}
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: next}})
+		}
+	}
+	return BatchWrite(ctx, svc, table, requests)
+}
+
+// yamlMigration is a migration file such as migrations/0002_add_index.yaml:
+//
+//	version: 2
+//	description: index items by attribute
+//	up:
+//	  - addIndex: {table: my-table, name: by-attribute, partitionKey: {name: attribute, type: S}}
+//	down:
+//	  - removeIndex: {table: my-table, name: by-attribute}
+type yamlMigration struct {
+	Version     int        `yaml:"version"`
+	Description string     `yaml:"description"`
+	Up          []yamlStep `yaml:"up"`
+	Down        []yamlStep `yaml:"down"`
+}
+
+// yamlStep holds exactly one action.
+type yamlStep struct {
+	CreateTable    *TableSpec     `yaml:"createTable"`
+	DeleteTable    *TableSpec     `yaml:"deleteTable"`
+	AddIndex       *IndexConfig   `yaml:"addIndex"`
+	RemoveIndex    *IndexConfig   `yaml:"removeIndex"`
+	TransformItems *yamlTransform `yaml:"transformItems"`
+}
+
+// yamlTransform sets constant attributes, renames and removes attributes on every item of a table.
+type yamlTransform struct {
+	Table  string            `yaml:"table"`
+	Set    map[string]any    `yaml:"set"`
+	Rename map[string]string `yaml:"rename"`
+	Remove []string          `yaml:"remove"`
+}
+
+// validate checks that the step sets exactly one action.
+func (s yamlStep) validate() error {
+	var actions []string
+	if s.CreateTable != nil {
+		actions = append(actions, "createTable")
+	}
+	if s.DeleteTable != nil {
+		actions = append(actions, "deleteTable")
+	}
+	if s.AddIndex != nil {
+		actions = append(actions, "addIndex")
+	}
+	if s.RemoveIndex != nil {
+		actions = append(actions, "removeIndex")
+	}
+	if s.TransformItems != nil {
+		actions = append(actions, "transformItems")
+	}
+	switch len(actions) {
+	case 0:
+		return errors.New("no action")
+	case 1:
+		return nil
+	}
+	return fmt.Errorf("%d actions %v, use one step per action", len(actions), actions)
+}
+
+func (s yamlStep) run(ctx context.Context, svc *dynamodb.Client) error {
+	switch {
+	case s.CreateTable != nil:
+		return CreateTableFromSpec(ctx, svc, *s.CreateTable)
+	case s.DeleteTable != nil:
+		return DeleteTable(ctx, svc, s.DeleteTable.Name)
+	case s.AddIndex != nil:
+		if err := AddIndex(ctx, svc, s.AddIndex.Table, s.AddIndex.spec()); err != nil {
+			return err
+		}
+		return WaitForIndex(ctx, svc, s.AddIndex.Table, s.AddIndex.Name, false, nil)
+	case s.RemoveIndex != nil:
+		if err := RemoveIndex(ctx, svc, s.RemoveIndex.Table, s.RemoveIndex.Name); err != nil {
+			return err
+		}
+		return WaitForIndex(ctx, svc, s.RemoveIndex.Table, s.RemoveIndex.Name, true, nil)
+	case s.TransformItems != nil:
+		t := s.TransformItems
+		set, err := marshalItem(t.Set)
+		if err != nil {
+			return err
+		}
+		_, err = TransformItems(ctx, svc, t.Table, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+			for from, to := range t.Rename {
+				if v, ok := item[from]; ok {
+					item[to] = v
+					delete(item, from)
+				}
+			}
+			for _, name := range t.Remove {
+				delete(item, name)
+			}
+			for name, v := range set {
+				item[name] = v
+			}
+			return item, nil
+		})
+		return err
+	}
+	return errors.New("migration step has no action")
+}
+
+// LoadYAMLMigrations reads every *.yaml and *.yml file of dir. A missing dir yields no migrations.
+func LoadYAMLMigrations(dir string) ([]Migration, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var ym yamlMigration
+		if err := yaml.Unmarshal(data, &ym); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if ym.Version <= 0 {
+			return nil, fmt.Errorf("%s: version must be positive", file)
+		}
+		if err := validateSteps(ym.Up); err != nil {
+			return nil, fmt.Errorf("%s: up %w", file, err)
+		}
+		if err := validateSteps(ym.Down); err != nil {
+			return nil, fmt.Errorf("%s: down %w", file, err)
+		}
+		migrations = append(migrations, Migration{
+			Version:     ym.Version,
+			Description: ym.Description,
+			Up:          yamlSteps(ym.Up),
+			Down:        yamlSteps(ym.Down),
+		})
+	}
+	return migrations, nil
+}
+
+func validateSteps(steps []yamlStep) error {
+	for i, step := range steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func yamlSteps(steps []yamlStep) func(context.Context, *dynamodb.Client) error {
+	return func(ctx context.Context, svc *dynamodb.Client) error {
+		for i, step := range steps {
+			if err := step.run(ctx, svc); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Migrator applies migrations and records them in the migrations table.
+type Migrator struct {
+	Client     *dynamodb.Client
+	Table      string
+	Migrations []Migration
+}
+
+// NewMigrator sorts the migrations and rejects duplicate versions.
+func NewMigrator(svc *dynamodb.Client, table string, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", sorted[i].Version)
+		}
+	}
+	return &Migrator{Client: svc, Table: table, Migrations: sorted}, nil
+}
+
+// Applied returns the recorded migrations by version. A missing migrations table means
+// that none has been applied; it is only created by Up.
+func (m *Migrator) Applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	applied := map[int]AppliedMigration{}
+	paginator := dynamodb.NewScanPaginator(m.Client, &dynamodb.ScanInput{
+		TableName:      aws.String(m.Table),
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return applied, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rows []AppliedMigration
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &rows); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			applied[row.Version] = row
+		}
+	}
+	return applied, nil
+}
+
+// Up applies every pending migration up to and including target, all of them if target is 0.
+// It creates the migrations table if needed.
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	err := CreateTableFromSpec(ctx, m.Client, TableSpec{
+		Name:         m.Table,
+		PartitionKey: KeySpec{Name: "version", Type: "N"},
+		OnDemand:     true,
+	})
+	if err != nil {
+		return err
+	}
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range m.Migrations {
+		if target > 0 && mig.Version > target {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		log.Printf("Applying %d %s\n", mig.Version, mig.Description)
+		if mig.Up != nil {
+			if err := mig.Up(ctx, m.Client); err != nil {
+				return fmt.Errorf("migration %d up: %w", mig.Version, err)
+			}
+		}
+		item, err := marshalItem(AppliedMigration{Version: mig.Version, Description: mig.Description, AppliedAt: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		if _, err := m.Client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(m.Table), Item: item}); err != nil {
+			return fmt.Errorf("record migration %d: %w", mig.Version, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.Migrations) - 1; i >= 0 && steps > 0; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return fmt.Errorf("migration %d cannot be reverted", mig.Version)
+		}
+		log.Printf("Reverting %d %s\n", mig.Version, mig.Description)
+		if err := mig.Down(ctx, m.Client); err != nil {
+			return fmt.Errorf("migration %d down: %w", mig.Version, err)
+		}
+		_, err := m.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(m.Table),
+			Key:       map[string]types.AttributeValue{"version": &types.AttributeValueMemberN{Value: strconv.Itoa(mig.Version)}},
+		})
+		if err != nil {
+			return fmt.Errorf("unrecord migration %d: %w", mig.Version, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// MigrateCommand handles `migrate up|down|status`.
+//
+//	migrate up -to 3 -dir cmd/dynamodb/migrations
+//	migrate down -steps 1
+//	migrate status
+func MigrateCommand(svc *dynamodb.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	dir := fs.String("dir", "cmd/dynamodb/migrations", "directory of YAML migrations")
+	table := fs.String("table", MIGRATIONS_TABLE, "table recording applied versions")
+	to := fs.Int("to", 0, "last version to apply, 0 for all (up only)")
+	steps := fs.Int("steps", 1, "number of migrations to revert (down only)")
+	fs.Parse(args[1:])
+
+	yamlMigrations, err := LoadYAMLMigrations(*dir)
+	if err != nil {
+		return err
+	}
+	migrator, err := NewMigrator(svc, *table, append(Migrations, yamlMigrations...))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	switch action {
+	case "up":
+		return migrator.Up(ctx, *to)
+	case "down":
+		return migrator.Down(ctx, *steps)
+	case "status":
+		applied, err := migrator.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrator.Migrations {
+			status := "pending"
+			if a, ok := applied[mig.Version]; ok {
+				status = "applied " + a.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Printf("%4d  %-28s  %s\n", mig.Version, status, mig.Description)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate action %q", action)
+}
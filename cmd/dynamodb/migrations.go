@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Migrations written in Go. YAML migrations from the migrations directory are merged with
+// these by version, so a version number must be used only once across both.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create " + DBTABLE_NAME,
+		Up: func(ctx context.Context, svc *dynamodb.Client) error {
+			return CreateTableFromSpec(ctx, svc, TableSpec{
+				Name:         DBTABLE_NAME,
+				PartitionKey: KeySpec{Name: DBPRIMARY_KEY, Type: "S"},
+				SortKey:      &KeySpec{Name: DBSORT_KEY, Type: "S"},
+			})
+		},
+		Down: func(ctx context.Context, svc *dynamodb.Client) error {
+			return DeleteTable(ctx, svc, DBTABLE_NAME)
+		},
+	},
+}
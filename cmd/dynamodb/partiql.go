@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Parameter formats
+const (
+	// ParamsJSON reads parameters as plain JSON values: "text", 1, true, [..], {..}.
+	ParamsJSON = "json"
+	// ParamsDynamoJSON reads parameters in DynamoDB-JSON: {"S": "text"}, {"N": "1"}.
+	ParamsDynamoJSON = "dynamodb"
+)
+
+// maxBatchStatements is the BatchExecuteStatement limit per request
+const maxBatchStatements = 25
+
+// Statement is a PartiQL statement with its positional (?) parameters.
+type Statement struct {
+	Statement  string            `json:"statement"`
+	Parameters []json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ExecuteAll runs a statement and follows NextToken until every page is read.
+// limit caps the number of items read per page, 0 for no cap.
+func ExecuteAll(ctx context.Context, svc *dynamodb.Client, statement string, params []types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, error) {
+	input := &dynamodb.ExecuteStatementInput{
+		Statement:  aws.String(statement),
+		Parameters: params,
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(limit)
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		out, err := svc.ExecuteStatement(ctx, input)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, out.Items...)
+		if out.NextToken == nil {
+			return items, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// ParseParameter reads a parameter in the given format, ParamsJSON or ParamsDynamoJSON. The
+// format is never guessed, as a plain JSON object such as {"S": "x"} is also valid DynamoDB-JSON.
+func ParseParameter(raw, format string) (types.AttributeValue, error) {
+	switch format {
+	case ParamsDynamoJSON:
+		return AttributeFromDynamoJSON(json.RawMessage(raw))
+	case ParamsJSON:
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s is not JSON, quote strings as '\"text\"': %w", raw, err)
+		}
+		return AttributeFromPlain(v)
+	}
+	return nil, fmt.Errorf("unknown parameter format %q, use json or dynamodb", format)
+}
+
+func parseParameters(raws []json.RawMessage, format string) ([]types.AttributeValue, error) {
+	params := make([]types.AttributeValue, len(raws))
+	for i, raw := range raws {
+		p, err := ParseParameter(string(raw), format)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		params[i] = p
+	}
+	return params, nil
+}
+
+// readStatements reads a JSON array of Statement from a file.
+func readStatements(file string) ([]Statement, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []Statement
+	return stmts, json.Unmarshal(data, &stmts)
+}
+
+// BatchExecute runs independent statements with BatchExecuteStatement, 25 per request. The
+// returned errors are per statement, nil for the statements that succeeded. When a request
+// fails, the results of the requests before it are returned with the error.
+func BatchExecute(ctx context.Context, svc *dynamodb.Client, stmts []Statement, paramsFormat string) ([]map[string]types.AttributeValue, []error, error) {
+	requests := make([]types.BatchStatementRequest, len(stmts))
+	for i, s := range stmts {
+		params, err := parseParameters(s.Parameters, paramsFormat)
+		if err != nil {
+			return nil, nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		requests[i] = types.BatchStatementRequest{
+			Statement:  aws.String(s.Statement),
+			Parameters: params,
+		}
+	}
+
+	var (
+		items []map[string]types.AttributeValue
+		errs  []error
+	)
+	for start := 0; start < len(requests); start += maxBatchStatements {
+		end := min(start+maxBatchStatements, len(requests))
+		out, err := svc.BatchExecuteStatement(ctx, &dynamodb.BatchExecuteStatementInput{
+			Statements: requests[start:end],
+		})
+		if err != nil {
+			return items, errs, fmt.Errorf("statements %d to %d: %w", start+1, end, err)
+		}
+		for _, resp := range out.Responses {
+			items = append(items, resp.Item)
+			var err error
+			if resp.Error != nil {
+				err = fmt.Errorf("%s: %s", resp.Error.Code, aws.ToString(resp.Error.Message))
+			}
+			errs = append(errs, err)
+		}
+	}
+	return items, errs, nil
+}
+
+// ExecuteTransaction runs the statements atomically with ExecuteTransaction.
+func ExecuteTransaction(ctx context.Context, svc *dynamodb.Client, stmts []Statement, paramsFormat string) ([]map[string]types.AttributeValue, error) {
+	input := &dynamodb.ExecuteTransactionInput{}
+	for _, s := range stmts {
+		params, err := parseParameters(s.Parameters, paramsFormat)
+		if err != nil {
+			return nil, err
+		}
+		input.TransactStatements = append(input.TransactStatements, types.ParameterizedStatement{
+			Statement:  aws.String(s.Statement),
+			Parameters: params,
+		})
+	}
+	out, err := svc.ExecuteTransaction(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]types.AttributeValue, len(out.Responses))
+	for i, resp := range out.Responses {
+		items[i] = resp.Item
+	}
+	return items, nil
+}
+
+// PrintItems writes items as an aligned table, or as one JSON object per line when format is "json".
+func PrintItems(w io.Writer, items []map[string]types.AttributeValue, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			if err := enc.Encode(ItemToPlain(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		for k := range item {
+			seen[k] = true
+		}
+	}
+	columns := sortedKeys(seen)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, item := range items {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			if av, ok := item[col]; ok {
+				cells[i] = formatCell(av)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	fmt.Fprintf(tw, "(%d items)\n", len(items))
+	return tw.Flush()
+}
+
+func formatCell(av types.AttributeValue) string {
+	if s, ok := av.(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(AttributeToPlain(av))
+	return strings.TrimSpace(buf.String())
+}
+
+// paramList collects repeated -param flags.
+type paramList []json.RawMessage
+
+func (p *paramList) String() string { return fmt.Sprint(len(*p)) }
+
+func (p *paramList) Set(v string) error {
+	*p = append(*p, json.RawMessage(v))
+	return nil
+}
+
+// PartiQLCommand handles `partiql exec|batch|tx|repl`.
+//
+//	partiql exec -param '"my-partition-key"' 'SELECT * FROM "my-table" WHERE pkey = ?'
+//	partiql exec -params-format dynamodb -param '{"S": "my-partition-key"}' 'SELECT * FROM "my-table" WHERE pkey = ?'
+//	partiql batch -file statements.json
+//	partiql tx -file statements.json
+//	partiql repl
+func PartiQLCommand(svc *dynamodb.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: partiql exec|batch|tx|repl [flags]")
+	}
+	action := args[0]
+
+	var params paramList
+	fs := flag.NewFlagSet("partiql "+action, flag.ExitOnError)
+	output := fs.String("output", "table", "output format: table or json")
+	file := fs.String("file", "", "JSON array of {statement, parameters} (batch and tx only)")
+	limit := fs.Int("limit", 0, "items per page (exec only)")
+	paramsFormat := fs.String("params-format", ParamsJSON, "format of the parameters: json or dynamodb")
+	fs.Var(&params, "param", "statement parameter in -params-format, repeatable (exec only)")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	switch action {
+	case "exec":
+		if fs.NArg() != 1 {
+			return errors.New("exec takes exactly one statement")
+		}
+		avs, err := parseParameters(params, *paramsFormat)
+		if err != nil {
+			return err
+		}
+		items, err := ExecuteAll(ctx, svc, fs.Arg(0), avs, int32(*limit))
+		if err != nil {
+			return err
+		}
+		return PrintItems(os.Stdout, items, *output)
+	case "batch":
+		stmts, err := readStatements(*file)
+		if err != nil {
+			return err
+		}
+		items, errs, err := BatchExecute(ctx, svc, stmts, *paramsFormat)
+		for i, e := range errs {
+			if e != nil {
+				fmt.Printf("statement %d failed: %v\n", i+1, e)
+			}
+		}
+		if perr := PrintItems(os.Stdout, nonEmpty(items), *output); err == nil {
+			err = perr
+		}
+		return err
+	case "tx":
+		stmts, err := readStatements(*file)
+		if err != nil {
+			return err
+		}
+		items, err := ExecuteTransaction(ctx, svc, stmts, *paramsFormat)
+		if err != nil {
+			return err
+		}
+		return PrintItems(os.Stdout, nonEmpty(items), *output)
+	case "repl":
+		return RunREPL(ctx, svc, os.Stdin, os.Stdout, *output)
+	}
+	return fmt.Errorf("unknown partiql action %q", action)
+}
+
+// RunREPL reads statements terminated by ';' and prints their results. Lines starting with '.'
+// are commands: .json, .table, .quit.
+func RunREPL(ctx context.Context, svc *dynamodb.Client, in io.Reader, out io.Writer, format string) error {
+	scanner := bufio.NewScanner(in)
+	var pending strings.Builder
+
+	prompt := func() {
+		if pending.Len() == 0 {
+			fmt.Fprint(out, "partiql> ")
+		} else {
+			fmt.Fprint(out, "     ... ")
+		}
+	}
+
+	prompt()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case pending.Len() == 0 && line == ".quit":
+			return nil
+		case pending.Len() == 0 && (line == ".json" || line == ".table"):
+			format = strings.TrimPrefix(line, ".")
+		case line != "":
+			pending.WriteString(line)
+			pending.WriteString("\n")
+			if strings.HasSuffix(line, ";") {
+				stmt := strings.TrimSuffix(strings.TrimSpace(pending.String()), ";")
+				pending.Reset()
+				if items, err := ExecuteAll(ctx, svc, stmt, nil, 0); err != nil {
+					fmt.Fprintln(out, "error:", err)
+				} else {
+					PrintItems(out, items, format)
+				}
+			}
+		}
+		prompt()
+	}
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
+
+func nonEmpty(items []map[string]types.AttributeValue) []map[string]types.AttributeValue {
+	var out []map[string]types.AttributeValue
+	for _, item := range items {
+		if len(item) > 0 {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// shardEnd is the checkpoint value of a shard that has been read to its end
+const shardEnd = "SHARD_END"
+
+// StreamRecord is a change record with its images converted to DynamoDB attribute values,
+// so they can be decoded with attributevalue.UnmarshalMap.
+type StreamRecord struct {
+	ShardID        string
+	EventID        string
+	EventName      streamtypes.OperationType // INSERT, MODIFY or REMOVE
+	SequenceNumber string
+	CreatedAt      time.Time
+	Keys           map[string]types.AttributeValue
+	NewImage       map[string]types.AttributeValue // absent for REMOVE and KEYS_ONLY streams
+	OldImage       map[string]types.AttributeValue // absent for INSERT and NEW_IMAGE streams
+}
+
+// StreamHandler receives the records of one GetRecords call, in order for their shard.
+// Shards are read concurrently, so the handler is called from several goroutines at once
+// for different shards. Returning an error stops the reader without checkpointing the batch.
+type StreamHandler func(ctx context.Context, records []StreamRecord) error
+
+// Checkpointer stores the last processed sequence number of every shard.
+type Checkpointer interface {
+	Get(shardID string) (string, bool)
+	Set(shardID, sequenceNumber string) error
+}
+
+// MemoryCheckpointer keeps checkpoints for the lifetime of the process.
+type MemoryCheckpointer struct {
+	mu   sync.Mutex
+	seqs map[string]string
+}
+
+func (c *MemoryCheckpointer) Get(shardID string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq, ok := c.seqs[shardID]
+	return seq, ok
+}
+
+func (c *MemoryCheckpointer) Set(shardID, sequenceNumber string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seqs == nil {
+		c.seqs = map[string]string{}
+	}
+	c.seqs[shardID] = sequenceNumber
+	return nil
+}
+
+// FileCheckpointer persists checkpoints as a JSON object in a file, so a restarted reader
+// continues after the last processed record.
+type FileCheckpointer struct {
+	MemoryCheckpointer
+	Path string
+
+	write sync.Mutex
+}
+
+// NewFileCheckpointer loads the checkpoints stored at path, if any.
+func NewFileCheckpointer(path string) (*FileCheckpointer, error) {
+	c := &FileCheckpointer{Path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, json.Unmarshal(data, &c.seqs)
+}
+
+func (c *FileCheckpointer) Set(shardID, sequenceNumber string) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+	c.MemoryCheckpointer.Set(shardID, sequenceNumber)
+
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.seqs, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := c.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// EnableStream turns on the table stream with the given view type if it is not enabled yet,
+// waits for the table to become ACTIVE and returns the stream ARN.
+func EnableStream(ctx context.Context, svc *dynamodb.Client, table string, viewType types.StreamViewType) (string, error) {
+	desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return "", err
+	}
+	if spec := desc.Table.StreamSpecification; spec != nil && aws.ToBool(spec.StreamEnabled) {
+		return aws.ToString(desc.Table.LatestStreamArn), nil
+	}
+
+	_, err = svc.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(table),
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: viewType,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("enable stream on %s: %w", table, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(svc)
+	out, err := waiter.WaitForOutput(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, 2*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Table.LatestStreamArn), nil
+}
+
+// StreamReader walks every shard of a stream. Child shards created by splits are read only
+// after their parent has been read to its end, so records of one key stay in order.
+type StreamReader struct {
+	Client    *dynamodbstreams.Client
+	StreamArn string
+	// Checkpoints defaults to a MemoryCheckpointer
+	Checkpoints Checkpointer
+	// StartAt applies to shards without a checkpoint: TRIM_HORIZON (default) or LATEST.
+	// Children of a shard read from LATEST begin at LATEST as well, other shards discovered
+	// after the reader started begin at TRIM_HORIZON.
+	StartAt streamtypes.ShardIteratorType
+	// PollInterval is the wait between empty GetRecords calls and shard discovery, default 1s
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	started map[string]streamtypes.ShardIteratorType
+	done    map[string]bool
+}
+
+// shardStart is a shard ready to be read and where to start it without a checkpoint
+type shardStart struct {
+	ID      string
+	StartAt streamtypes.ShardIteratorType
+}
+
+// Run reads the stream until ctx is cancelled or the handler returns an error.
+func (r *StreamReader) Run(ctx context.Context, handler StreamHandler) error {
+	if r.Checkpoints == nil {
+		r.Checkpoints = &MemoryCheckpointer{}
+	}
+	if r.StartAt == "" {
+		r.StartAt = streamtypes.ShardIteratorTypeTrimHorizon
+	}
+	if r.PollInterval == 0 {
+		r.PollInterval = time.Second
+	}
+	r.started = map[string]streamtypes.ShardIteratorType{}
+	r.done = map[string]bool{}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		errCh = make(chan error, 1)
+		first = true
+	)
+	defer wg.Wait()
+
+	for {
+		shards, err := r.describeShards(ctx)
+		if err != nil {
+			// A failed shard cancels ctx, which fails the describe call as well
+			select {
+			case shardErr := <-errCh:
+				return shardErr
+			default:
+			}
+			return err
+		}
+
+		for _, shard := range r.readyShards(shards, first) {
+			wg.Add(1)
+			go func(shard shardStart) {
+				defer wg.Done()
+				if err := r.readShard(ctx, shard.ID, shard.StartAt, handler); err != nil && ctx.Err() == nil {
+					select {
+					case errCh <- fmt.Errorf("shard %s: %w", shard.ID, err):
+					default:
+					}
+					cancel()
+				}
+			}(shard)
+		}
+		first = false
+
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			select {
+			case err := <-errCh:
+				return err
+			default:
+				return ctx.Err()
+			}
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// readyShards returns the shards that are not started yet and whose parent is finished or gone.
+// A child starts where its parent started, so the child of a shard read from LATEST does not
+// replay records from before the reader started. Children of shards read in an earlier run and
+// shards that appear after the first poll start at TRIM_HORIZON, all others at StartAt.
+func (r *StreamReader) readyShards(shards []streamtypes.Shard, first bool) []shardStart {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known := map[string]bool{}
+	for _, s := range shards {
+		known[aws.ToString(s.ShardId)] = true
+	}
+
+	var ready []shardStart
+	for _, s := range shards {
+		id := aws.ToString(s.ShardId)
+		if _, ok := r.started[id]; ok || r.done[id] {
+			continue
+		}
+		if seq, ok := r.Checkpoints.Get(id); ok && seq == shardEnd {
+			r.done[id] = true
+			continue
+		}
+		parent := aws.ToString(s.ParentShardId)
+		if parent != "" && known[parent] && !r.done[parent] {
+			if seq, ok := r.Checkpoints.Get(parent); !ok || seq != shardEnd {
+				continue
+			}
+		}
+
+		startAt := r.StartAt
+		if parentStart, ok := r.started[parent]; ok {
+			startAt = parentStart
+		} else if _, ok := r.Checkpoints.Get(parent); ok || !first {
+			startAt = streamtypes.ShardIteratorTypeTrimHorizon
+		}
+		// A shard continuing from a checkpoint misses nothing, so its children start at TRIM_HORIZON
+		if _, ok := r.Checkpoints.Get(id); ok {
+			r.started[id] = streamtypes.ShardIteratorTypeTrimHorizon
+		} else {
+			r.started[id] = startAt
+		}
+		ready = append(ready, shardStart{ID: id, StartAt: startAt})
+	}
+	return ready
+}
+
+func (r *StreamReader) describeShards(ctx context.Context) ([]streamtypes.Shard, error) {
+	var (
+		shards []streamtypes.Shard
+		last   *string
+	)
+	for {
+		out, err := r.Client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(r.StreamArn),
+			ExclusiveStartShardId: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe stream: %w", err)
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+		last = out.StreamDescription.LastEvaluatedShardId
+		if last == nil {
+			return shards, nil
+		}
+	}
+}
+
+// shardIterator starts after the checkpoint of the shard, or at startAt without one.
+func (r *StreamReader) shardIterator(ctx context.Context, shardID string, startAt streamtypes.ShardIteratorType) (*string, error) {
+	seq, _ := r.Checkpoints.Get(shardID)
+	return r.iteratorAfter(ctx, shardID, seq, startAt)
+}
+
+// iteratorAfter starts after the sequence number, or at startAt when it is empty.
+func (r *StreamReader) iteratorAfter(ctx context.Context, shardID, seq string, startAt streamtypes.ShardIteratorType) (*string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(r.StreamArn),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: startAt,
+	}
+	if seq != "" {
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(seq)
+	}
+	out, err := r.Client.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.ShardIterator, nil
+}
+
+func (r *StreamReader) readShard(ctx context.Context, shardID string, startAt streamtypes.ShardIteratorType, handler StreamHandler) error {
+	iterator, err := r.shardIterator(ctx, shardID, startAt)
+	if err != nil {
+		return err
+	}
+	// last is the sequence number of the last record handled, a restart continues after it
+	last, _ := r.Checkpoints.Get(shardID)
+
+	for iterator != nil {
+		out, err := r.Client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		var expired *streamtypes.ExpiredIteratorException
+		if errors.As(err, &expired) {
+			// Iterators live for 15 minutes. Start again after the last record handled, or where
+			// the shard started without one.
+			if iterator, err = r.iteratorAfter(ctx, shardID, last, startAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Records without stream data are skipped, so a page may convert to no records
+		records, err := convertStreamRecords(shardID, out.Records)
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			if err := handler(ctx, records); err != nil {
+				return err
+			}
+			last = records[len(records)-1].SequenceNumber
+			if err := r.Checkpoints.Set(shardID, last); err != nil {
+				return err
+			}
+		}
+
+		iterator = out.NextShardIterator
+		if iterator != nil && len(out.Records) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.PollInterval):
+			}
+		}
+	}
+
+	// A nil iterator means the shard is closed and fully read
+	r.mu.Lock()
+	r.done[shardID] = true
+	r.mu.Unlock()
+	return r.Checkpoints.Set(shardID, shardEnd)
+}
+
+func convertStreamRecords(shardID string, in []streamtypes.Record) ([]StreamRecord, error) {
+	out := make([]StreamRecord, 0, len(in))
+	for _, rec := range in {
+		if rec.Dynamodb == nil {
+			continue
+		}
+		sr := StreamRecord{
+			ShardID:        shardID,
+			EventID:        aws.ToString(rec.EventID),
+			EventName:      rec.EventName,
+			SequenceNumber: aws.ToString(rec.Dynamodb.SequenceNumber),
+			CreatedAt:      aws.ToTime(rec.Dynamodb.ApproximateCreationDateTime),
+		}
+		var err error
+		if sr.Keys, err = attributevalue.FromDynamoDBStreamsMap(rec.Dynamodb.Keys); err != nil {
+			return nil, err
+		}
+		if sr.NewImage, err = attributevalue.FromDynamoDBStreamsMap(rec.Dynamodb.NewImage); err != nil {
+			return nil, err
+		}
+		if sr.OldImage, err = attributevalue.FromDynamoDBStreamsMap(rec.Dynamodb.OldImage); err != nil {
+			return nil, err
+		}
+		out = append(out, sr)
+	}
+	return out, nil
+}
+
+// StreamCommand handles `stream -table my-table -checkpoint stream.json`. It enables the stream
+// if needed and prints every change until interrupted.
+func StreamCommand(provider aws.Config, svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to follow")
+	viewType := fs.String("view", string(types.StreamViewTypeNewAndOldImages), "stream view type used when enabling the stream")
+	from := fs.String("from", string(streamtypes.ShardIteratorTypeTrimHorizon), "TRIM_HORIZON or LATEST for shards without a checkpoint")
+	checkpoint := fs.String("checkpoint", "", "file to store checkpoints in")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	arn, err := EnableStream(ctx, svc, *table, types.StreamViewType(*viewType))
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading stream %s\n", arn)
+
+	reader := &StreamReader{
+		Client:    dynamodbstreams.NewFromConfig(provider),
+		StreamArn: arn,
+		StartAt:   streamtypes.ShardIteratorType(*from),
+	}
+	if *checkpoint != "" {
+		if reader.Checkpoints, err = NewFileCheckpointer(*checkpoint); err != nil {
+			return err
+		}
+	}
+
+	err = reader.Run(ctx, func(ctx context.Context, records []StreamRecord) error {
+		for _, rec := range records {
+			keys, _ := json.Marshal(ItemToPlain(rec.Keys))
+			fmt.Printf("%s %s %s keys=%s\n", rec.CreatedAt.Format(time.DateTime), rec.EventName, rec.SequenceNumber, keys)
+			if rec.OldImage != nil {
+				old, _ := json.Marshal(ItemToPlain(rec.OldImage))
+				fmt.Printf("  old: %s\n", old)
+			}
+			if rec.NewImage != nil {
+				img, _ := json.Marshal(ItemToPlain(rec.NewImage))
+				fmt.Printf("  new: %s\n", img)
+			}
+		}
+		return nil
+	})
+	// Only an interrupt ends the command without an error
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
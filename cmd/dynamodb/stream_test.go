@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func testShard(id, parent string) streamtypes.Shard {
+	s := streamtypes.Shard{ShardId: aws.String(id)}
+	if parent != "" {
+		s.ParentShardId = aws.String(parent)
+	}
+	return s
+}
+
+func TestReadyShards(t *testing.T) {
+	const (
+		trim   = streamtypes.ShardIteratorTypeTrimHorizon
+		latest = streamtypes.ShardIteratorTypeLatest
+	)
+	tests := []struct {
+		name        string
+		startAt     streamtypes.ShardIteratorType
+		checkpoints map[string]string
+		// first and second are the shards ready on the first poll and, after the first poll's
+		// shards are read to their end, on the second poll
+		first, second []shardStart
+	}{
+		{
+			name:    "trim horizon",
+			startAt: trim,
+			first:   []shardStart{{"a", trim}, {"c", trim}},
+			second:  []shardStart{{"b", trim}, {"new", trim}},
+		},
+		{
+			name:    "latest is inherited by children",
+			startAt: latest,
+			first:   []shardStart{{"a", latest}, {"c", latest}},
+			second:  []shardStart{{"b", latest}, {"new", trim}},
+		},
+		{
+			name:        "checkpointed parent",
+			startAt:     latest,
+			checkpoints: map[string]string{"a": "100"},
+			first:       []shardStart{{"a", latest}, {"c", latest}},
+			second:      []shardStart{{"b", trim}, {"new", trim}},
+		},
+		{
+			name:        "parent read in an earlier run",
+			startAt:     latest,
+			checkpoints: map[string]string{"a": shardEnd},
+			first:       []shardStart{{"b", trim}, {"c", latest}},
+			second:      []shardStart{{"new", trim}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoints := &MemoryCheckpointer{}
+			for id, seq := range tt.checkpoints {
+				checkpoints.Set(id, seq)
+			}
+			r := &StreamReader{
+				Checkpoints: checkpoints,
+				StartAt:     tt.startAt,
+				started:     map[string]streamtypes.ShardIteratorType{},
+				done:        map[string]bool{},
+			}
+			shards := []streamtypes.Shard{testShard("a", ""), testShard("b", "a"), testShard("c", "gone")}
+			if got := r.readyShards(shards, true); !reflect.DeepEqual(got, tt.first) {
+				t.Errorf("first poll = %v, want %v", got, tt.first)
+			}
+			for _, s := range tt.first {
+				r.done[s.ID] = true
+				checkpoints.Set(s.ID, shardEnd)
+			}
+			shards = append(shards, testShard("new", ""))
+			if got := r.readyShards(shards, false); !reflect.DeepEqual(got, tt.second) {
+				t.Errorf("second poll = %v, want %v", got, tt.second)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTransactItems is the TransactWriteItems limit per request
+const maxTransactItems = 100
+
+// Transaction collects Put/Update/Delete/ConditionCheck actions, possibly on different tables,
+// and commits them atomically with TransactWriteItems.
+//
+//	err := NewTransaction().
+//		Put("orders", order, WithCondition("attribute_not_exists(pkey)")).
+//		Update("stock", key, "SET qty = qty - :n", WithCondition("qty >= :n"), WithValues(map[string]any{":n": 1})).
+//		Commit(ctx, svc)
+type Transaction struct {
+	items []types.TransactWriteItem
+	ops   []string
+	token string
+	err   error
+}
+
+// TxOption sets the optional expression parts of a transaction action.
+type TxOption func(*txExpr)
+
+type txExpr struct {
+	condition  string
+	names      map[string]string
+	values     any
+	returnOnCC bool
+}
+
+// WithCondition sets the ConditionExpression of the action.
+func WithCondition(expr string) TxOption {
+	return func(e *txExpr) { e.condition = expr }
+}
+
+// WithNames sets the ExpressionAttributeNames of the action.
+func WithNames(names map[string]string) TxOption {
+	return func(e *txExpr) { e.names = names }
+}
+
+// WithValues sets the ExpressionAttributeValues of the action, marshaled with attributevalue.MarshalMap.
+func WithValues(values any) TxOption {
+	return func(e *txExpr) { e.values = values }
+}
+
+// ReturnOldOnFailure asks DynamoDB to return the current item in the cancellation reason
+// when the condition fails.
+func ReturnOldOnFailure() TxOption {
+	return func(e *txExpr) { e.returnOnCC = true }
+}
+
+// NewTransaction returns an empty transaction.
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// WithToken sets the ClientRequestToken. Committing the same token and actions again within
+// ten minutes succeeds without applying the writes twice. When unset the SDK generates a token per call.
+func (t *Transaction) WithToken(token string) *Transaction {
+	t.token = token
+	return t
+}
+
+// Put adds a PutItem action. The item is a map[string]types.AttributeValue or any value accepted
+// by attributevalue.MarshalMap.
+func (t *Transaction) Put(table string, item any, opts ...TxOption) *Transaction {
+	av, e := t.prepare(item, opts)
+	t.add("Put", types.TransactWriteItem{Put: &types.Put{
+		TableName:                           aws.String(table),
+		Item:                                av,
+		ConditionExpression:                 e.conditionExpression(),
+		ExpressionAttributeNames:            e.names,
+		ExpressionAttributeValues:           t.values(e),
+		ReturnValuesOnConditionCheckFailure: e.returnValues(),
+	}})
+	return t
+}
+
+// Update adds an UpdateItem action.
+func (t *Transaction) Update(table string, key any, update string, opts ...TxOption) *Transaction {
+	av, e := t.prepare(key, opts)
+	t.add("Update", types.TransactWriteItem{Update: &types.Update{
+		TableName:                           aws.String(table),
+		Key:                                 av,
+		UpdateExpression:                    aws.String(update),
+		ConditionExpression:                 e.conditionExpression(),
+		ExpressionAttributeNames:            e.names,
+		ExpressionAttributeValues:           t.values(e),
+		ReturnValuesOnConditionCheckFailure: e.returnValues(),
+	}})
+	return t
+}
+
+// Delete adds a DeleteItem action.
+func (t *Transaction) Delete(table string, key any, opts ...TxOption) *Transaction {
+	av, e := t.prepare(key, opts)
+	t.add("Delete", types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                           aws.String(table),
+		Key:                                 av,
+		ConditionExpression:                 e.conditionExpression(),
+		ExpressionAttributeNames:            e.names,
+		ExpressionAttributeValues:           t.values(e),
+		ReturnValuesOnConditionCheckFailure: e.returnValues(),
+	}})
+	return t
+}
+
+// ConditionCheck adds a check on an item that is not written but must match the condition
+// for the transaction to succeed.
+func (t *Transaction) ConditionCheck(table string, key any, condition string, opts ...TxOption) *Transaction {
+	// opts may share its array with the caller's slice, so the condition goes into a copy
+	opts = append(opts[:len(opts):len(opts)], WithCondition(condition))
+	av, e := t.prepare(key, opts)
+	t.add("ConditionCheck", types.TransactWriteItem{ConditionCheck: &types.ConditionCheck{
+		TableName:                           aws.String(table),
+		Key:                                 av,
+		ConditionExpression:                 e.conditionExpression(),
+		ExpressionAttributeNames:            e.names,
+		ExpressionAttributeValues:           t.values(e),
+		ReturnValuesOnConditionCheckFailure: e.returnValues(),
+	}})
+	return t
+}
+
+// Commit sends the transaction. A cancelled transaction returns a *TransactionError.
+func (t *Transaction) Commit(ctx context.Context, svc *dynamodb.Client) error {
+	if t.err != nil {
+		return t.err
+	}
+	if len(t.items) == 0 {
+		return errors.New("transaction has no actions")
+	}
+	if len(t.items) > maxTransactItems {
+		return fmt.Errorf("transaction has %d actions, the limit is %d", len(t.items), maxTransactItems)
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: t.items,
+	}
+	if t.token != "" {
+		input.ClientRequestToken = aws.String(t.token)
+	}
+	_, err := svc.TransactWriteItems(ctx, input)
+
+	var tce *types.TransactionCanceledException
+	if errors.As(err, &tce) {
+		return t.cancellationError(tce)
+	}
+	return err
+}
+
+func (t *Transaction) prepare(v any, opts []TxOption) (map[string]types.AttributeValue, *txExpr) {
+	e := &txExpr{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	av, err := marshalItem(v)
+	if err != nil && t.err == nil {
+		t.err = fmt.Errorf("action %d: %w", len(t.items), err)
+	}
+	return av, e
+}
+
+func (t *Transaction) values(e *txExpr) map[string]types.AttributeValue {
+	if e.values == nil {
+		return nil
+	}
+	av, err := marshalItem(e.values)
+	if err != nil && t.err == nil {
+		t.err = fmt.Errorf("action %d values: %w", len(t.items), err)
+	}
+	return av
+}
+
+func (t *Transaction) add(op string, item types.TransactWriteItem) {
+	t.items = append(t.items, item)
+	t.ops = append(t.ops, op)
+}
+
+func (t *Transaction) cancellationError(tce *types.TransactionCanceledException) error {
+	txErr := &TransactionError{Err: tce}
+	for i, reason := range tce.CancellationReasons {
+		code := aws.ToString(reason.Code)
+		if code == "" || code == "None" {
+			continue
+		}
+		itemErr := TxItemError{
+			Index:   i,
+			Code:    code,
+			Message: aws.ToString(reason.Message),
+			Item:    reason.Item,
+		}
+		if i < len(t.ops) {
+			itemErr.Op = t.ops[i]
+			itemErr.Table = transactTable(t.items[i])
+		}
+		txErr.Items = append(txErr.Items, itemErr)
+	}
+	return txErr
+}
+
+func (e *txExpr) conditionExpression() *string {
+	if e.condition == "" {
+		return nil
+	}
+	return aws.String(e.condition)
+}
+
+func (e *txExpr) returnValues() types.ReturnValuesOnConditionCheckFailure {
+	if e.returnOnCC {
+		return types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+	return ""
+}
+
+// TxItemError is the cancellation reason of one action of a failed transaction.
+type TxItemError struct {
+	Index   int
+	Op      string
+	Table   string
+	Code    string // e.g. ConditionalCheckFailed, TransactionConflict, ValidationError
+	Message string
+	Item    map[string]types.AttributeValue // set with ReturnOldOnFailure
+}
+
+func (e TxItemError) Error() string {
+	return fmt.Sprintf("action %d (%s %s): %s %s", e.Index, e.Op, e.Table, e.Code, e.Message)
+}
+
+// TransactionError is returned by Commit when DynamoDB cancels the transaction.
+// Items holds only the actions that caused the cancellation.
+type TransactionError struct {
+	Items []TxItemError
+	Err   *types.TransactionCanceledException
+}
+
+func (e *TransactionError) Error() string {
+	if len(e.Items) == 0 {
+		return "transaction cancelled: " + e.Err.ErrorMessage()
+	}
+	msgs := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		msgs[i] = item.Error()
+	}
+	return "transaction cancelled: " + strings.Join(msgs, "; ")
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// ConditionFailed reports whether the action at index failed its condition expression.
+func (e *TransactionError) ConditionFailed(index int) bool {
+	for _, item := range e.Items {
+		if item.Index == index {
+			return item.Code == "ConditionalCheckFailed"
+		}
+	}
+	return false
+}
+
+func transactTable(item types.TransactWriteItem) string {
+	switch {
+	case item.Put != nil:
+		return aws.ToString(item.Put.TableName)
+	case item.Update != nil:
+		return aws.ToString(item.Update.TableName)
+	case item.Delete != nil:
+		return aws.ToString(item.Delete.TableName)
+	case item.ConditionCheck != nil:
+		return aws.ToString(item.ConditionCheck.TableName)
+	}
+	return ""
+}
+
+// marshalItem accepts an already marshaled item or any value accepted by attributevalue.MarshalMap.
+func marshalItem(v any) (map[string]types.AttributeValue, error) {
+	if av, ok := v.(map[string]types.AttributeValue); ok {
+		return av, nil
+	}
+	return attributevalue.MarshalMap(v)
+}
+
+// TransactCommand handles `transact -token abc`. It writes an item and bumps a counter item
+// atomically, and fails when the item already exists.
+func TransactCommand(svc *dynamodb.Client, args []string) error {
+	fs := flag.NewFlagSet("transact", flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table to write to")
+	token := fs.String("token", "", "idempotency token (ClientRequestToken)")
+	sk := fs.String("skey", "my-sort-key-"+time.Now().Format(time.RFC3339), "sort key of the new item")
+	fs.Parse(args)
+
+	item := map[string]any{
+		DBPRIMARY_KEY: "my-partition-key",
+		DBSORT_KEY:    *sk,
+		"attribute":   "my-attribute-value",
+	}
+	counter := map[string]any{
+		DBPRIMARY_KEY: "my-partition-key",
+		DBSORT_KEY:    "counter",
+	}
+
+	err := NewTransaction().
+		WithToken(*token).
+		Put(*table, item, WithCondition("attribute_not_exists(#pk)"), WithNames(map[string]string{"#pk": DBPRIMARY_KEY})).
+		Update(*table, counter, "ADD #count :one", WithNames(map[string]string{"#count": "count"}), WithValues(map[string]any{":one": 1})).
+		Commit(context.TODO(), svc)
+
+	var txErr *TransactionError
+	if errors.As(err, &txErr) {
+		for _, item := range txErr.Items {
+			log.Printf("Failed %v\n", item)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Transaction committed")
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCancellationError(t *testing.T) {
+	key := map[string]types.AttributeValue{"pkey": &types.AttributeValueMemberS{Value: "a"}}
+	old := map[string]types.AttributeValue{"pkey": &types.AttributeValueMemberS{Value: "a"}, "qty": &types.AttributeValueMemberN{Value: "0"}}
+	tx := NewTransaction().
+		Put("orders", key).
+		Update("stock", key, "SET qty = qty - :n").
+		ConditionCheck("customers", key, "attribute_exists(pkey)")
+
+	reason := func(code, msg string, item map[string]types.AttributeValue) types.CancellationReason {
+		return types.CancellationReason{Code: aws.String(code), Message: aws.String(msg), Item: item}
+	}
+	tests := []struct {
+		name    string
+		reasons []types.CancellationReason
+		want    []TxItemError
+	}{
+		{
+			name:    "no reasons",
+			reasons: nil,
+			want:    nil,
+		},
+		{
+			name: "one failed condition",
+			reasons: []types.CancellationReason{
+				reason("None", "", nil),
+				reason("ConditionalCheckFailed", "The conditional request failed", old),
+				reason("None", "", nil),
+			},
+			want: []TxItemError{
+				{Index: 1, Op: "Update", Table: "stock", Code: "ConditionalCheckFailed", Message: "The conditional request failed", Item: old},
+			},
+		},
+		{
+			name: "several reasons, empty codes skipped",
+			reasons: []types.CancellationReason{
+				reason("TransactionConflict", "Transaction is ongoing for the item", nil),
+				{},
+				reason("ConditionalCheckFailed", "The conditional request failed", nil),
+			},
+			want: []TxItemError{
+				{Index: 0, Op: "Put", Table: "orders", Code: "TransactionConflict", Message: "Transaction is ongoing for the item"},
+				{Index: 2, Op: "ConditionCheck", Table: "customers", Code: "ConditionalCheckFailed", Message: "The conditional request failed"},
+			},
+		},
+		{
+			name: "more reasons than actions",
+			reasons: []types.CancellationReason{
+				reason("None", "", nil),
+				reason("None", "", nil),
+				reason("None", "", nil),
+				reason("ValidationError", "unexpected", nil),
+			},
+			want: []TxItemError{
+				{Index: 3, Code: "ValidationError", Message: "unexpected"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tce := &types.TransactionCanceledException{Message: aws.String("Transaction cancelled"), CancellationReasons: tt.reasons}
+			err := tx.cancellationError(tce)
+			var txErr *TransactionError
+			if !errors.As(err, &txErr) {
+				t.Fatalf("cancellationError() = %T, want *TransactionError", err)
+			}
+			if !reflect.DeepEqual(txErr.Items, tt.want) {
+				t.Errorf("items = %+v, want %+v", txErr.Items, tt.want)
+			}
+			var unwrapped *types.TransactionCanceledException
+			if !errors.As(err, &unwrapped) || unwrapped != tce {
+				t.Error("error does not unwrap to the TransactionCanceledException")
+			}
+			for _, item := range tt.want {
+				if got := txErr.ConditionFailed(item.Index); got != (item.Code == "ConditionalCheckFailed") {
+					t.Errorf("ConditionFailed(%d) = %t for code %s", item.Index, got, item.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestConditionCheckKeepsOptions(t *testing.T) {
+	opts := make([]TxOption, 1, 2)
+	opts[0] = WithNames(map[string]string{"#q": "qty"})
+	spare := opts[:2]
+	spare[1] = WithCondition("caller")
+
+	tx := NewTransaction().ConditionCheck("stock", map[string]types.AttributeValue{"pkey": &types.AttributeValueMemberS{Value: "a"}}, "#q > :zero", opts...)
+	if got := aws.ToString(tx.items[0].ConditionCheck.ConditionExpression); got != "#q > :zero" {
+		t.Errorf("condition = %q, want #q > :zero", got)
+	}
+	e := &txExpr{}
+	spare[1](e)
+	if e.condition != "caller" {
+		t.Errorf("ConditionCheck overwrote the caller's option array, condition = %q", e.condition)
+	}
+}
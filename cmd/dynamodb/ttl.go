@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TTLCommand handles `ttl enable|disable|status|sweep`.
+//
+//	ttl enable -attribute expiresAt
+//	ttl disable
+//	ttl status
+//	ttl sweep -dry-run
+func TTLCommand(svc *dynamodb.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: ttl enable|disable|status|sweep [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("ttl "+action, flag.ExitOnError)
+	table := fs.String("table", DBTABLE_NAME, "table name")
+	attribute := fs.String("attribute", "expiresAt", "TTL attribute, epoch seconds (enable only)")
+	dryRun := fs.Bool("dry-run", false, "only count expired items (sweep only)")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	switch action {
+	case "enable":
+		if err := SetTTL(ctx, svc, *table, *attribute, true); err != nil {
+			return err
+		}
+		log.Printf("TTL enabled on %s using %s\n", *table, *attribute)
+	case "disable":
+		status, err := DescribeTTL(ctx, svc, *table)
+		if err != nil {
+			return err
+		}
+		if status.AttributeName == nil {
+			log.Printf("TTL is not enabled on %s\n", *table)
+			return nil
+		}
+		if err := SetTTL(ctx, svc, *table, aws.ToString(status.AttributeName), false); err != nil {
+			return err
+		}
+		log.Printf("TTL disabled on %s\n", *table)
+	case "status":
+		status, err := DescribeTTL(ctx, svc, *table)
+		if err != nil {
+			return err
+		}
+		log.Printf("TTL on %s: %s, attribute: %s\n", *table, status.TimeToLiveStatus, aws.ToString(status.AttributeName))
+	case "sweep":
+		n, err := SweepExpired(ctx, svc, *table, *dryRun)
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			log.Printf("%d expired items in %s\n", n, *table)
+		} else {
+			log.Printf("Deleted %d expired items from %s\n", n, *table)
+		}
+	default:
+		return fmt.Errorf("unknown ttl action %q", action)
+	}
+	return nil
+}
+
+// SetTTL enables or disables TTL on the table. Disabling needs the attribute that is currently in use.
+func SetTTL(ctx context.Context, svc *dynamodb.Client, table, attribute string, enabled bool) error {
+	_, err := svc.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(table),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(enabled),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("update ttl on %s: %w", table, err)
+	}
+	return nil
+}
+
+// DescribeTTL returns the TTL status and attribute of the table.
+func DescribeTTL(ctx context.Context, svc *dynamodb.Client, table string) (*types.TimeToLiveDescription, error) {
+	out, err := svc.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe ttl on %s: %w", table, err)
+	}
+	if out.TimeToLiveDescription == nil {
+		return nil, fmt.Errorf("describe ttl on %s: no TTL description returned", table)
+	}
+	return out.TimeToLiveDescription, nil
+}
+
+// SweepExpired deletes the items whose TTL attribute is in the past, the way DynamoDB would
+// eventually do, but right away. LocalStack runs its TTL deletion on its own schedule, so tests
+// of expiry behavior call this instead of waiting. TTL must be enabled on the table, and every
+// delete is conditional on the item still being expired, so an item whose TTL was extended
+// after the scan is kept. It returns the number of expired items, or of deleted items.
+func SweepExpired(ctx context.Context, svc *dynamodb.Client, table string, dryRun bool) (int, error) {
+	status, err := DescribeTTL(ctx, svc, table)
+	if err != nil {
+		return 0, err
+	}
+	if status.TimeToLiveStatus != types.TimeToLiveStatusEnabled || status.AttributeName == nil {
+		return 0, fmt.Errorf("TTL is not enabled on %s (status %s)", table, status.TimeToLiveStatus)
+	}
+	attribute := aws.ToString(status.AttributeName)
+	now := map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+
+	keyNames, err := tableKeyNames(ctx, svc, table)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only project the key attributes, they are all a delete needs
+	names := map[string]string{"#ttl": attribute}
+	projection := make([]string, len(keyNames))
+	for i, k := range keyNames {
+		alias := fmt.Sprintf("#k%d", i)
+		names[alias] = k
+		projection[i] = alias
+	}
+
+	var keys []map[string]types.AttributeValue
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:                 aws.String(table),
+		FilterExpression:          aws.String("#ttl <= :now"),
+		ProjectionExpression:      aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: now,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("scan %s: %w", table, err)
+		}
+		keys = append(keys, page.Items...)
+	}
+	if dryRun {
+		return len(keys), nil
+	}
+
+	// BatchWriteItem has no conditions, so every item is deleted on its own
+	deleted := 0
+	for _, key := range keys {
+		_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(table),
+			Key:                       key,
+			ConditionExpression:       aws.String("#ttl <= :now"),
+			ExpressionAttributeNames:  map[string]string{"#ttl": attribute},
+			ExpressionAttributeValues: now,
+		})
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("delete expired item from %s: %w", table, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// tableKeyNames returns the partition key name followed by the sort key name, if any.
+func tableKeyNames(ctx context.Context, svc *dynamodb.Client, table string) ([]string, error) {
+	desc, err := svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, 2)
+	for _, kt := range []types.KeyType{types.KeyTypeHash, types.KeyTypeRange} {
+		for _, k := range desc.Table.KeySchema {
+			if k.KeyType == kt {
+				names = append(names, aws.ToString(k.AttributeName))
+			}
+		}
+	}
+	return names, nil
+}
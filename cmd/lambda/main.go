@@ -2,10 +2,28 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+
+	_ "app/env"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+var (
+	// AWS_REGION is the region to use
+	AWS_REGION = os.Getenv("LOCALSTACK_DEFAULT_REGION")
+	// AWS_ACCESS_KEY_ID is the access key ID
+	AWS_ACCESS_KEY_ID = os.Getenv("LOCALSTACK_ACCESS_KEY_ID")
+	// AWS_SECRET_ACCESS_KEY is the secret access key
+	AWS_SECRET_ACCESS_KEY = os.Getenv("LOCALSTACK_SECRET_ACCESS_KEY")
+	// AWS_ENDPOINT is the endpoint for LocalStack
+	AWS_ENDPOINT = os.Getenv("LOCALSTACK_ENDPOINT")
 )
 
 func handler(ctx context.Context, req *events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
@@ -32,5 +50,36 @@ func handler(ctx context.Context, req *events.APIGatewayProxyRequest) (*events.A
 func main() {
 	log.SetPrefix("")
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	// Run a handler locally against LocalStack, e.g. `go run ./cmd/lambda sqs -queue my-queue`
+	if len(os.Args) > 1 {
+		RunCommand(os.Args[1], os.Args[2:])
+		return
+	}
 	lambda.Start(handler)
 }
+
+func RunCommand(name string, args []string) {
+	provider, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(AWS_REGION),
+		config.WithBaseEndpoint(AWS_ENDPOINT),
+		config.WithCredentialsProvider(
+			aws.NewCredentialsCache(
+				credentials.NewStaticCredentialsProvider(AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, ""),
+			),
+		),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+
+	switch name {
+	case "sqs":
+		err = SQSCommand(provider, args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maxReceiveMessages is the SQS limit of messages per ReceiveMessage call
+const maxReceiveMessages = 10
+
+// SQSHandler is the signature of a Lambda function triggered by SQS with ReportBatchItemFailures
+// enabled.
+type SQSHandler func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error)
+
+// SQSPoller runs an SQS handler in-process the way the Lambda event source mapping does: it
+// receives batches, invokes the handler and deletes the messages that succeeded. Failed messages
+// stay on the queue and are retried once their visibility timeout expires.
+type SQSPoller struct {
+	Client   *sqs.Client
+	QueueURL string
+	Region   string
+	// BatchSize is the maximum number of messages per invocation, default 10
+	BatchSize int
+	// BatchWindow is how long to gather messages for a batch, default 0 invokes as soon as
+	// one receive returns messages
+	BatchWindow time.Duration
+	// VisibilityTimeout in seconds, like the function timeout it should exceed, default 30
+	VisibilityTimeout int32
+
+	queueArn string
+}
+
+// Run polls until ctx is cancelled. The invocation in progress completes before returning.
+func (p *SQSPoller) Run(ctx context.Context, handler SQSHandler) error {
+	if p.BatchSize <= 0 {
+		p.BatchSize = maxReceiveMessages
+	}
+	if p.VisibilityTimeout <= 0 {
+		p.VisibilityTimeout = 30
+	}
+	arn, err := p.Client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(p.QueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return fmt.Errorf("get queue arn: %w", err)
+	}
+	p.queueArn = arn.Attributes[string(types.QueueAttributeNameQueueArn)]
+
+	for ctx.Err() == nil {
+		msgs, err := p.gather(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to receive messages: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+		if len(msgs) > 0 {
+			p.invoke(context.WithoutCancel(ctx), msgs, handler)
+		}
+	}
+	return nil
+}
+
+// gather receives messages until the batch is full or the batch window, which opens with the
+// first message, has passed.
+func (p *SQSPoller) gather(ctx context.Context) ([]types.Message, error) {
+	var (
+		batch    []types.Message
+		deadline time.Time
+	)
+	for len(batch) < p.BatchSize {
+		// Wait for the first message as long as possible, then until the window closes
+		wait := int32(20)
+		if len(batch) > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				break
+			}
+			wait = int32(min((remaining+time.Second-1)/time.Second, 20))
+		}
+		out, err := p.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(p.QueueURL),
+			MaxNumberOfMessages:         int32(min(maxReceiveMessages, p.BatchSize-len(batch))),
+			WaitTimeSeconds:             wait,
+			VisibilityTimeout:           p.VisibilityTimeout,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			return batch, err
+		}
+		if len(batch) == 0 && len(out.Messages) > 0 {
+			deadline = time.Now().Add(p.BatchWindow)
+		}
+		batch = append(batch, out.Messages...)
+	}
+	return batch, nil
+}
+
+// invoke runs the handler and deletes the successful messages. Like Lambda, an error, a panic
+// or a failure with an unknown item identifier fails the whole batch.
+func (p *SQSPoller) invoke(ctx context.Context, msgs []types.Message, handler SQSHandler) {
+	event := p.event(msgs)
+
+	resp, err := func() (resp events.SQSEventResponse, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("handler panic: %v", r)
+			}
+		}()
+		return handler(ctx, event)
+	}()
+	if err != nil {
+		log.Printf("Invocation with %d messages failed: %v", len(msgs), err)
+		return
+	}
+
+	failed := map[string]bool{}
+	for _, f := range resp.BatchItemFailures {
+		failed[f.ItemIdentifier] = true
+	}
+	var done []types.Message
+	for _, msg := range msgs {
+		if failed[aws.ToString(msg.MessageId)] {
+			delete(failed, aws.ToString(msg.MessageId))
+			continue
+		}
+		done = append(done, msg)
+	}
+	if len(failed) > 0 {
+		log.Printf("Invocation reported unknown item identifiers, failing the batch of %d messages", len(msgs))
+		return
+	}
+
+	deleted, err := p.delete(ctx, done)
+	if err != nil {
+		log.Printf("Failed to delete messages: %v", err)
+	}
+	log.Printf("Invocation with %d messages: %d deleted, %d failed\n", len(msgs), deleted, len(resp.BatchItemFailures))
+}
+
+// event builds the Lambda event of a batch.
+func (p *SQSPoller) event(msgs []types.Message) events.SQSEvent {
+	event := events.SQSEvent{Records: make([]events.SQSMessage, len(msgs))}
+	for i, msg := range msgs {
+		record := events.SQSMessage{
+			MessageId:              aws.ToString(msg.MessageId),
+			ReceiptHandle:          aws.ToString(msg.ReceiptHandle),
+			Body:                   aws.ToString(msg.Body),
+			Md5OfBody:              aws.ToString(msg.MD5OfBody),
+			Md5OfMessageAttributes: aws.ToString(msg.MD5OfMessageAttributes),
+			Attributes:             msg.Attributes,
+			MessageAttributes:      make(map[string]events.SQSMessageAttribute, len(msg.MessageAttributes)),
+			EventSourceARN:         p.queueArn,
+			EventSource:            "aws:sqs",
+			AWSRegion:              p.Region,
+		}
+		for name, attr := range msg.MessageAttributes {
+			record.MessageAttributes[name] = events.SQSMessageAttribute{
+				StringValue:      attr.StringValue,
+				BinaryValue:      attr.BinaryValue,
+				StringListValues: attr.StringListValues,
+				BinaryListValues: attr.BinaryListValues,
+				DataType:         aws.ToString(attr.DataType),
+			}
+		}
+		event.Records[i] = record
+	}
+	return event
+}
+
+func (p *SQSPoller) delete(ctx context.Context, msgs []types.Message) (int, error) {
+	deleted := 0
+	for start := 0; start < len(msgs); start += maxReceiveMessages {
+		chunk := msgs[start:min(start+maxReceiveMessages, len(msgs))]
+		entries := make([]types.DeleteMessageBatchRequestEntry, len(chunk))
+		for i, msg := range chunk {
+			entries[i] = types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: msg.ReceiptHandle,
+			}
+		}
+		out, err := p.Client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(p.QueueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return deleted, err
+		}
+		for _, f := range out.Failed {
+			log.Printf("Failed to delete message %s: %s", aws.ToString(f.Id), aws.ToString(f.Message))
+		}
+		deleted += len(out.Successful)
+	}
+	return deleted, nil
+}
+
+// sqsHandler is the sample SQS function: it logs every message and fails those whose body
+// contains "fail", so partial batch failures can be tried out.
+func sqsHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var resp events.SQSEventResponse
+	for _, record := range event.Records {
+		log.Printf("%+v\n", map[string]any{
+			"MessageId":      record.MessageId,
+			"Body":           record.Body,
+			"ReceiveCount":   record.Attributes["ApproximateReceiveCount"],
+			"EventSourceARN": record.EventSourceARN,
+		})
+		if strings.Contains(record.Body, "fail") {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+	return resp, nil
+}
+
+// SQSCommand handles `sqs -queue my-queue -batch 10 -window 2s` and runs sqsHandler locally.
+func SQSCommand(provider aws.Config, args []string) error {
+	fs := flag.NewFlagSet("sqs", flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	batch := fs.Int("batch", 10, "maximum messages per invocation")
+	window := fs.Duration("window", 0, "batch window")
+	visibility := fs.Int("visibility", 30, "visibility timeout in seconds")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	svc := sqs.NewFromConfig(provider)
+	url, err := svc.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(*queue)})
+	if err != nil {
+		return fmt.Errorf("get url of queue %s: %w", *queue, err)
+	}
+
+	poller := &SQSPoller{
+		Client:            svc,
+		QueueURL:          aws.ToString(url.QueueUrl),
+		Region:            provider.Region,
+		BatchSize:         *batch,
+		BatchWindow:       *window,
+		VisibilityTimeout: int32(*visibility),
+	}
+	log.Printf("Polling %s\n", poller.QueueURL)
+	err = poller.Run(ctx, sqsHandler)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// attributeAliases maps short flag names to the settable queue attributes.
+var attributeAliases = map[string]types.QueueAttributeName{
+	"visibility": types.QueueAttributeNameVisibilityTimeout,
+	"retention":  types.QueueAttributeNameMessageRetentionPeriod,
+	"delay":      types.QueueAttributeNameDelaySeconds,
+	"max-size":   types.QueueAttributeNameMaximumMessageSize,
+	"wait":       types.QueueAttributeNameReceiveMessageWaitTimeSeconds,
+	"policy":     types.QueueAttributeNamePolicy,
+	"redrive":    types.QueueAttributeNameRedrivePolicy,
+}
+
+// depthAttributes are the message counts shown by the monitor.
+var depthAttributes = []types.QueueAttributeName{
+	types.QueueAttributeNameApproximateNumberOfMessages,
+	types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+	types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+}
+
+// ListQueueURLs returns the URLs of all queues whose name starts with prefix.
+func ListQueueURLs(ctx context.Context, svc *sqs.Client, prefix string) ([]string, error) {
+	input := &sqs.ListQueuesInput{}
+	if prefix != "" {
+		input.QueueNamePrefix = aws.String(prefix)
+	}
+	var urls []string
+	paginator := sqs.NewListQueuesPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, page.QueueUrls...)
+	}
+	return urls, nil
+}
+
+// QueueName returns the name of a queue from its URL.
+func QueueName(queueURL string) string {
+	return path.Base(queueURL)
+}
+
+// GetQueueAttributes returns the given attributes of a queue, all of them when none are given.
+func GetQueueAttributes(ctx context.Context, svc *sqs.Client, queueURL string, names ...types.QueueAttributeName) (map[string]string, error) {
+	if len(names) == 0 {
+		names = []types.QueueAttributeName{types.QueueAttributeNameAll}
+	}
+	out, err := svc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get attributes of %s: %w", QueueName(queueURL), err)
+	}
+	return out.Attributes, nil
+}
+
+// SetQueueAttributes sets queue attributes by their SQS name, e.g. VisibilityTimeout.
+func SetQueueAttributes(ctx context.Context, svc *sqs.Client, queueURL string, attrs map[string]string) error {
+	_, err := svc.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(queueURL),
+		Attributes: attrs,
+	})
+	if err != nil {
+		return fmt.Errorf("set attributes of %s: %w", QueueName(queueURL), err)
+	}
+	return nil
+}
+
+// PurgeQueue deletes all messages of a queue. SQS allows one purge per queue every 60 seconds.
+func PurgeQueue(ctx context.Context, svc *sqs.Client, queueURL string) error {
+	_, err := svc.PurgeQueue(ctx, &sqs.PurgeQueueInput{QueueUrl: aws.String(queueURL)})
+	var inProgress *types.PurgeQueueInProgress
+	if errors.As(err, &inProgress) {
+		return fmt.Errorf("purge %s: a purge ran in the last 60 seconds", QueueName(queueURL))
+	}
+	return err
+}
+
+// DeleteQueue deletes a queue.
+func DeleteQueue(ctx context.Context, svc *sqs.Client, queueURL string) error {
+	_, err := svc.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(queueURL)})
+	return err
+}
+
+// TagQueue adds or replaces tags of a queue.
+func TagQueue(ctx context.Context, svc *sqs.Client, queueURL string, tags map[string]string) error {
+	_, err := svc.TagQueue(ctx, &sqs.TagQueueInput{QueueUrl: aws.String(queueURL), Tags: tags})
+	return err
+}
+
+// UntagQueue removes tags of a queue.
+func UntagQueue(ctx context.Context, svc *sqs.Client, queueURL string, keys []string) error {
+	_, err := svc.UntagQueue(ctx, &sqs.UntagQueueInput{QueueUrl: aws.String(queueURL), TagKeys: keys})
+	return err
+}
+
+// ListQueueTags returns the tags of a queue.
+func ListQueueTags(ctx context.Context, svc *sqs.Client, queueURL string) (map[string]string, error) {
+	out, err := svc.ListQueueTags(ctx, &sqs.ListQueueTagsInput{QueueUrl: aws.String(queueURL)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Tags, nil
+}
+
+// QueueDepth is the approximate number of messages of a queue.
+type QueueDepth struct {
+	Name     string
+	Visible  int
+	InFlight int
+	Delayed  int
+}
+
+// GetQueueDepth reads the ApproximateNumberOfMessages* attributes of a queue.
+func GetQueueDepth(ctx context.Context, svc *sqs.Client, queueURL string) (QueueDepth, error) {
+	attrs, err := GetQueueAttributes(ctx, svc, queueURL, depthAttributes...)
+	if err != nil {
+		return QueueDepth{}, err
+	}
+	count := func(name types.QueueAttributeName) int {
+		n, _ := strconv.Atoi(attrs[string(name)])
+		return n
+	}
+	return QueueDepth{
+		Name:     QueueName(queueURL),
+		Visible:  count(types.QueueAttributeNameApproximateNumberOfMessages),
+		InFlight: count(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+		Delayed:  count(types.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+	}, nil
+}
+
+// Monitor prints the depth of the queues matching prefix every interval until ctx is cancelled.
+// The list of queues is refreshed on every tick so new queues show up.
+func Monitor(ctx context.Context, svc *sqs.Client, prefix string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		urls, err := ListQueueURLs(ctx, svc, prefix)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		// Clear the screen and move to the top left corner
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("%s  every %s, Ctrl-C to stop\n\n", time.Now().Format(time.TimeOnly), interval)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "QUEUE\tVISIBLE\tIN FLIGHT\tDELAYED\t")
+		for _, url := range urls {
+			depth, err := GetQueueDepth(ctx, svc, url)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t%v\t\t\t\n", QueueName(url), err)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", depth.Name, depth.Visible, depth.InFlight, depth.Delayed)
+		}
+		w.Flush()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseTags parses "key=value,key2=value2".
+func parseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("tag %q is not key=value", pair)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func printSorted(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		log.Printf("  %s: %s\n", k, m[k])
+	}
+}
+
+// QueueCommand handles `queue list|url|get|set|purge|delete|tag|untag|tags|monitor`.
+//
+//	queue list -prefix my-
+//	queue url -queue my-queue
+//	queue get -queue my-queue
+//	queue set -queue my-queue -visibility 60 -retention 86400 -delay 5 -max-size 1024 -policy policy.json
+//	queue purge -queue my-queue
+//	queue delete -queue my-queue
+//	queue tag -queue my-queue -tags env=dev,team=core
+//	queue untag -queue my-queue -tags env,team
+//	queue monitor -prefix my- -interval 2s
+func QueueCommand(svc *sqs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: queue list|url|get|set|purge|delete|tag|untag|tags|monitor [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("queue "+action, flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	prefix := fs.String("prefix", "", "queue name prefix (list and monitor only)")
+	tags := fs.String("tags", "", "key=value pairs to tag, keys to untag, comma separated")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval (monitor only)")
+	settings := map[string]*string{}
+	for alias, name := range attributeAliases {
+		usage := fmt.Sprintf("%s attribute (set only)", name)
+		if alias == "policy" || alias == "redrive" {
+			usage += ", @file reads it from a file"
+		}
+		settings[alias] = fs.String(alias, "", usage)
+	}
+	fs.Parse(args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch action {
+	case "list":
+		urls, err := ListQueueURLs(ctx, svc, *prefix)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			log.Printf("* %s\n", url)
+		}
+		return nil
+	case "monitor":
+		return Monitor(ctx, svc, *prefix, *interval)
+	}
+
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "url":
+		fmt.Println(url)
+		return nil
+	case "get":
+		attrs, err := GetQueueAttributes(ctx, svc, url)
+		if err != nil {
+			return err
+		}
+		printSorted(attrs)
+		return nil
+	case "set":
+		attrs := map[string]string{}
+		for alias, value := range settings {
+			if *value == "" {
+				continue
+			}
+			v := *value
+			if strings.HasPrefix(v, "@") {
+				data, err := os.ReadFile(v[1:])
+				if err != nil {
+					return err
+				}
+				v = string(data)
+			}
+			attrs[string(attributeAliases[alias])] = v
+		}
+		if len(attrs) == 0 {
+			return errors.New("no attribute to set")
+		}
+		if err := SetQueueAttributes(ctx, svc, url, attrs); err != nil {
+			return err
+		}
+		log.Printf("Updated %d attributes of %s\n", len(attrs), *queue)
+		return nil
+	case "purge":
+		if err := PurgeQueue(ctx, svc, url); err != nil {
+			return err
+		}
+		log.Printf("Purged %s\n", *queue)
+		return nil
+	case "delete":
+		if err := DeleteQueue(ctx, svc, url); err != nil {
+			return err
+		}
+		log.Printf("Deleted %s\n", *queue)
+		return nil
+	case "tag":
+		t, err := parseTags(*tags)
+		if err != nil {
+			return err
+		}
+		return TagQueue(ctx, svc, url, t)
+	case "untag":
+		return UntagQueue(ctx, svc, url, strings.Split(*tags, ","))
+	case "tags":
+		t, err := ListQueueTags(ctx, svc, url)
+		if err != nil {
+			return err
+		}
+		printSorted(t)
+		return nil
+	}
+	return fmt.Errorf("unknown queue action %q", action)
+}
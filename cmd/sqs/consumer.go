@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQS limits
+const (
+	maxBatchSize       = 10
+	maxWaitTimeSeconds = 20
+)
+
+// Handler processes one message. Returning nil deletes the message, an error leaves it on the
+// queue to be received again once its visibility timeout expires.
+type Handler func(ctx context.Context, msg types.Message) error
+
+// Consumer long-polls a queue and runs a handler on a fixed number of workers. While a handler
+// runs, the visibility timeout of its message is extended so slow handlers keep the message.
+// Only as many messages are received as there are idle workers, so no message waits for a
+// worker while its visibility timeout runs out.
+type Consumer struct {
+	Client   *sqs.Client
+	QueueURL string
+	// Workers is the number of concurrent handlers, default 4
+	Workers int
+	// WaitTimeSeconds is the long polling wait, default 20
+	WaitTimeSeconds int32
+	// MaxMessages per ReceiveMessage call, default 10
+	MaxMessages int32
+	// VisibilityTimeout in seconds, renewed every half period while a handler runs, default 30
+	VisibilityTimeout int32
+
+	deletes chan types.Message
+}
+
+// Run consumes until ctx is cancelled. In-flight handlers are allowed to finish, messages that
+// were received but not started are made visible again, and pending deletes are flushed.
+func (c *Consumer) Run(ctx context.Context, handler Handler) error {
+	c.setDefaults()
+
+	jobs := make(chan types.Message, c.Workers)
+	idle := make(chan struct{}, c.Workers)
+	for i := 0; i < c.Workers; i++ {
+		idle <- struct{}{}
+	}
+	c.deletes = make(chan types.Message, maxBatchSize)
+
+	var deleter sync.WaitGroup
+	deleter.Add(1)
+	go func() {
+		defer deleter.Done()
+		c.deleteLoop()
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < c.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for msg := range jobs {
+				if ctx.Err() != nil {
+					c.release(msg)
+				} else {
+					c.process(ctx, msg, handler)
+				}
+				idle <- struct{}{}
+			}
+		}()
+	}
+
+	err := c.receiveLoop(ctx, jobs, idle)
+	close(jobs)
+	workers.Wait()
+	close(c.deletes)
+	deleter.Wait()
+
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (c *Consumer) setDefaults() {
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	if c.WaitTimeSeconds <= 0 || c.WaitTimeSeconds > maxWaitTimeSeconds {
+		c.WaitTimeSeconds = maxWaitTimeSeconds
+	}
+	if c.MaxMessages <= 0 || c.MaxMessages > maxBatchSize {
+		c.MaxMessages = maxBatchSize
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = 30
+	}
+}
+
+// receive asks for up to n messages. Messages of a receive that completes while ctx is
+// cancelled are released, as nothing would handle them before their timeout.
+func (c *Consumer) receive(ctx context.Context, n int32) ([]types.Message, error) {
+	out, err := c.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(c.QueueURL),
+		MaxNumberOfMessages:         n,
+		WaitTimeSeconds:             c.WaitTimeSeconds,
+		VisibilityTimeout:           c.VisibilityTimeout,
+		MessageAttributeNames:       []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+	})
+	if ctx.Err() != nil {
+		if out != nil {
+			for _, msg := range out.Messages {
+				c.release(msg)
+			}
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// receiveLoop takes a token from idle for every message it receives, and the worker that
+// handled the message puts it back.
+func (c *Consumer) receiveLoop(ctx context.Context, jobs chan<- types.Message, idle chan struct{}) error {
+	for ctx.Err() == nil {
+		n := c.reserveWorkers(ctx, idle)
+		if n == 0 {
+			break
+		}
+		msgs, err := c.receive(ctx, n)
+		for i := int32(len(msgs)); i < n; i++ {
+			idle <- struct{}{}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Failed to receive messages: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			jobs <- msg
+		}
+	}
+	return ctx.Err()
+}
+
+// reserveWorkers waits for an idle worker and takes up to MaxMessages of them. It returns 0
+// when ctx is cancelled.
+func (c *Consumer) reserveWorkers(ctx context.Context, idle chan struct{}) int32 {
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-idle:
+	}
+	n := int32(1)
+	for n < c.MaxMessages {
+		select {
+		case <-idle:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// process runs the handler with a context that outlives shutdown, so in-flight work completes.
+func (c *Consumer) process(ctx context.Context, msg types.Message, handler Handler) {
+	handlerCtx := context.WithoutCancel(ctx)
+	stop := make(chan struct{})
+	go c.heartbeat(handlerCtx, msg, stop)
+
+	err := handler(handlerCtx, msg)
+	close(stop)
+
+	if err != nil {
+		log.Printf("Handler failed for message %s: %v", aws.ToString(msg.MessageId), err)
+		return
+	}
+	c.deletes <- msg
+}
+
+// heartbeat extends the visibility timeout every half period until stop is closed.
+func (c *Consumer) heartbeat(ctx context.Context, msg types.Message, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(c.VisibilityTimeout) * time.Second / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := c.Client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(c.QueueURL),
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: c.VisibilityTimeout,
+			})
+			if err != nil {
+				log.Printf("Failed to extend visibility of message %s: %v", aws.ToString(msg.MessageId), err)
+			}
+		}
+	}
+}
+
+// release makes a received message visible again right away.
+func (c *Consumer) release(msg types.Message) {
+	_, err := c.Client.ChangeMessageVisibility(context.Background(), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(c.QueueURL),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: 0,
+	})
+	if err != nil {
+		log.Printf("Failed to release message %s: %v", aws.ToString(msg.MessageId), err)
+	}
+}
+
+// deleteLoop deletes handled messages in batches of up to 10, flushing at least every 200ms.
+func (c *Consumer) deleteLoop() {
+	var (
+		batch  []types.Message
+		ticker = time.NewTicker(200 * time.Millisecond)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-c.deletes:
+			if !ok {
+				DeleteMessages(context.Background(), c.Client, c.QueueURL, batch)
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) == maxBatchSize {
+				DeleteMessages(context.Background(), c.Client, c.QueueURL, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				DeleteMessages(context.Background(), c.Client, c.QueueURL, batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// DeleteMessages deletes messages with DeleteMessageBatch, 10 at a time, and logs the entries
+// that failed. It returns the number of deleted messages.
+func DeleteMessages(ctx context.Context, svc *sqs.Client, queueURL string, msgs []types.Message) int {
+	deleted := 0
+	for start := 0; start < len(msgs); start += maxBatchSize {
+		chunk := msgs[start:min(start+maxBatchSize, len(msgs))]
+		entries := make([]types.DeleteMessageBatchRequestEntry, len(chunk))
+		for i, msg := range chunk {
+			entries[i] = types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: msg.ReceiptHandle,
+			}
+		}
+		out, err := svc.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			log.Printf("Failed to delete messages: %v", err)
+			continue
+		}
+		for _, f := range out.Failed {
+			log.Printf("Failed to delete message %s: %s", aws.ToString(f.Id), aws.ToString(f.Message))
+		}
+		deleted += len(out.Successful)
+	}
+	return deleted
+}
+
+// GetQueueURL looks up the URL of a queue by its name.
+func GetQueueURL(ctx context.Context, svc *sqs.Client, name string) (string, error) {
+	out, err := svc.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", fmt.Errorf("get url of queue %s: %w", name, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+// ConsumeCommand handles `consume -queue my-queue -workers 4 -work 45s`. Each message is logged,
+// and -work simulates a slow handler to show the visibility heartbeat.
+func ConsumeCommand(svc *sqs.Client, args []string) error {
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	workers := fs.Int("workers", 4, "concurrent handlers")
+	visibility := fs.Int("visibility", 30, "visibility timeout in seconds")
+	work := fs.Duration("work", 0, "time each handler takes")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	consumer := &Consumer{
+		Client:            svc,
+		QueueURL:          url,
+		Workers:           *workers,
+		VisibilityTimeout: int32(*visibility),
+	}
+	log.Printf("Consuming %s with %d workers\n", url, *workers)
+	return consumer.Run(ctx, func(ctx context.Context, msg types.Message) error {
+		log.Printf("  Message ID: %s\n", aws.ToString(msg.MessageId))
+		log.Printf("  Message Body: %s\n", aws.ToString(msg.Body))
+		time.Sleep(*work)
+		return nil
+	})
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// RedrivePolicy is the JSON value of the RedrivePolicy queue attribute. SQS returns
+// maxReceiveCount as a number but accepts it as a string too, json.Number reads both.
+type RedrivePolicy struct {
+	DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+	MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+}
+
+// GetRedrivePolicy returns the redrive policy of a queue, nil if it has none.
+func GetRedrivePolicy(ctx context.Context, svc *sqs.Client, queueURL string) (*RedrivePolicy, error) {
+	out, err := svc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameRedrivePolicy},
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := out.Attributes[string(types.QueueAttributeNameRedrivePolicy)]
+	if raw == "" {
+		return nil, nil
+	}
+	var policy RedrivePolicy
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return nil, fmt.Errorf("redrive policy %s: %w", raw, err)
+	}
+	return &policy, nil
+}
+
+// GetQueueArn returns the ARN of a queue.
+func GetQueueArn(ctx context.Context, svc *sqs.Client, queueURL string) (string, error) {
+	out, err := svc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.Attributes[string(types.QueueAttributeNameQueueArn)], nil
+}
+
+// CreateQueueWithDLQ creates the dead-letter queue and the source queue whose messages move to
+// it after maxReceiveCount failed receives. A ".fifo" name creates both queues as FIFO queues.
+// It returns the source and dead-letter queue URLs.
+func CreateQueueWithDLQ(ctx context.Context, svc *sqs.Client, name, dlqName string, maxReceiveCount int) (string, string, error) {
+	fifo := strings.HasSuffix(name, ".fifo")
+	attrs := func() map[string]string {
+		if !fifo {
+			return map[string]string{}
+		}
+		return map[string]string{string(types.QueueAttributeNameFifoQueue): "true"}
+	}
+
+	dlq, err := svc.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName:  aws.String(dlqName),
+		Attributes: attrs(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("create queue %s: %w", dlqName, err)
+	}
+	dlqArn, err := GetQueueArn(ctx, svc, aws.ToString(dlq.QueueUrl))
+	if err != nil {
+		return "", "", err
+	}
+
+	policy, err := json.Marshal(RedrivePolicy{
+		DeadLetterTargetArn: dlqArn,
+		MaxReceiveCount:     json.Number(strconv.Itoa(maxReceiveCount)),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	sourceAttrs := attrs()
+	sourceAttrs[string(types.QueueAttributeNameRedrivePolicy)] = string(policy)
+
+	src, err := svc.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: sourceAttrs,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("create queue %s: %w", name, err)
+	}
+	return aws.ToString(src.QueueUrl), aws.ToString(dlq.QueueUrl), nil
+}
+
+// SourceQueues returns the URLs of the queues that use the given queue as dead-letter queue.
+func SourceQueues(ctx context.Context, svc *sqs.Client, dlqURL string) ([]string, error) {
+	var urls []string
+	paginator := sqs.NewListDeadLetterSourceQueuesPaginator(svc, &sqs.ListDeadLetterSourceQueuesInput{
+		QueueUrl: aws.String(dlqURL),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, page.QueueUrls...)
+	}
+	return urls, nil
+}
+
+// InspectDLQ receives up to limit messages with a short visibility timeout and makes them visible
+// again before returning, so the dead-letter queue is left as it was.
+func InspectDLQ(ctx context.Context, svc *sqs.Client, dlqURL string, limit int) ([]types.Message, error) {
+	var (
+		msgs []types.Message
+		seen = map[string]bool{}
+	)
+	defer func() {
+		for _, msg := range msgs {
+			changeVisibility(ctx, svc, dlqURL, msg, 0)
+		}
+	}()
+
+	for len(msgs) < limit {
+		out, err := svc.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(dlqURL),
+			MaxNumberOfMessages:         int32(min(maxBatchSize, limit-len(msgs))),
+			VisibilityTimeout:           30,
+			WaitTimeSeconds:             1,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			return msgs, err
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		for _, msg := range out.Messages {
+			if !seen[aws.ToString(msg.MessageId)] {
+				seen[aws.ToString(msg.MessageId)] = true
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// RedriveFilter selects the messages to move back; nil selects all of them.
+type RedriveFilter func(msg types.Message) bool
+
+// Redrive moves messages from the dead-letter queue back to the source queue with their body and
+// message attributes, and deletes them from the dead-letter queue once sent. Messages that are
+// not selected are kept hidden during the run and made visible again at the end.
+// It returns the number of moved messages.
+func Redrive(ctx context.Context, svc *sqs.Client, dlqURL, sourceURL string, filter RedriveFilter) (int, error) {
+	var (
+		moved   int
+		skipped []types.Message
+	)
+	defer func() {
+		for _, msg := range skipped {
+			changeVisibility(ctx, svc, dlqURL, msg, 0)
+		}
+	}()
+
+	for {
+		out, err := svc.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(dlqURL),
+			MaxNumberOfMessages:         maxBatchSize,
+			VisibilityTimeout:           300,
+			WaitTimeSeconds:             1,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			return moved, err
+		}
+		if len(out.Messages) == 0 {
+			return moved, nil
+		}
+
+		var selected []types.Message
+		for _, msg := range out.Messages {
+			if filter == nil || filter(msg) {
+				selected = append(selected, msg)
+			} else {
+				skipped = append(skipped, msg)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		// The batch can exceed the 256KB SendMessageBatch limit, so it is sent in parts
+		outgoing := make([]OutgoingMessage, len(selected))
+		for i, msg := range selected {
+			outgoing[i] = OutgoingMessage{Body: aws.ToString(msg.Body), Attributes: msg.MessageAttributes, GroupID: MessageGroupID(msg)}
+		}
+		start := 0
+		for _, end := range splitBatches(outgoing) {
+			done, failed, err := redriveBatch(ctx, svc, sourceURL, selected[start:end])
+			skipped = append(skipped, failed...)
+			if err != nil {
+				skipped = append(skipped, selected[end:]...)
+				return moved, err
+			}
+			moved += DeleteMessages(ctx, svc, dlqURL, done)
+			start = end
+		}
+	}
+}
+
+// redriveBatch sends msgs to the source queue with one SendMessageBatch call and returns the
+// messages that were sent and those that failed.
+func redriveBatch(ctx context.Context, svc *sqs.Client, sourceURL string, msgs []types.Message) (done, failed []types.Message, err error) {
+	entries := make([]types.SendMessageBatchRequestEntry, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = types.SendMessageBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			MessageBody:       msg.Body,
+			MessageAttributes: msg.MessageAttributes,
+		}
+		if group := MessageGroupID(msg); group != "" {
+			entries[i].MessageGroupId = aws.String(group)
+			entries[i].MessageDeduplicationId = msg.MessageId
+		}
+	}
+	sent, err := svc.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(sourceURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, msgs, fmt.Errorf("send to source queue: %w", err)
+	}
+	for _, f := range sent.Failed {
+		i, _ := strconv.Atoi(aws.ToString(f.Id))
+		log.Printf("Failed to redrive message %s: %s", aws.ToString(msgs[i].MessageId), aws.ToString(f.Message))
+		failed = append(failed, msgs[i])
+	}
+	for _, s := range sent.Successful {
+		i, _ := strconv.Atoi(aws.ToString(s.Id))
+		done = append(done, msgs[i])
+	}
+	return done, failed, nil
+}
+
+func changeVisibility(ctx context.Context, svc *sqs.Client, queueURL string, msg types.Message, seconds int32) {
+	_, err := svc.ChangeMessageVisibility(context.WithoutCancel(ctx), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: seconds,
+	})
+	if err != nil {
+		log.Printf("Failed to change visibility of message %s: %v", aws.ToString(msg.MessageId), err)
+	}
+}
+
+// DLQCommand handles `dlq create|inspect|redrive`.
+//
+//	dlq create -queue my-queue -dlq my-queue-dlq -max-receive 3
+//	dlq inspect -dlq my-queue-dlq
+//	dlq redrive -dlq my-queue-dlq [-queue my-queue] [-ids id1,id2] [-contains text]
+func DLQCommand(svc *sqs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dlq create|inspect|redrive [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("dlq "+action, flag.ExitOnError)
+	queue := fs.String("queue", "", "source queue name, defaults to the only source of the DLQ for redrive")
+	dlq := fs.String("dlq", "my-queue-dlq", "dead-letter queue name")
+	maxReceive := fs.Int("max-receive", 3, "receives before a message moves to the DLQ (create only)")
+	limit := fs.Int("max", 100, "messages to show (inspect only)")
+	ids := fs.String("ids", "", "comma separated message IDs to redrive, all if empty")
+	contains := fs.String("contains", "", "only redrive messages whose body contains this text")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	if action == "create" {
+		if *queue == "" {
+			*queue = "my-queue"
+		}
+		src, dlqURL, err := CreateQueueWithDLQ(ctx, svc, *queue, *dlq, *maxReceive)
+		if err != nil {
+			return err
+		}
+		log.Printf("Queue URL: %s\n", src)
+		log.Printf("DLQ URL: %s\n", dlqURL)
+		return nil
+	}
+
+	dlqURL, err := GetQueueURL(ctx, svc, *dlq)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "inspect":
+		msgs, err := InspectDLQ(ctx, svc, dlqURL, *limit)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			log.Printf("  Message ID: %s (received %s times)\n", aws.ToString(msg.MessageId), msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+			log.Printf("  Message Body: %s\n", aws.ToString(msg.Body))
+			for name, attr := range msg.MessageAttributes {
+				log.Printf("  Attribute %s (%s): %s\n", name, aws.ToString(attr.DataType), aws.ToString(attr.StringValue))
+			}
+		}
+		log.Printf("%d messages in %s\n", len(msgs), *dlq)
+		return nil
+	case "redrive":
+		var sourceURL string
+		if *queue != "" {
+			if sourceURL, err = GetQueueURL(ctx, svc, *queue); err != nil {
+				return err
+			}
+		} else {
+			sources, err := SourceQueues(ctx, svc, dlqURL)
+			if err != nil {
+				return err
+			}
+			if len(sources) != 1 {
+				return fmt.Errorf("%s is the DLQ of %d queues, choose one with -queue", *dlq, len(sources))
+			}
+			sourceURL = sources[0]
+		}
+
+		var filter RedriveFilter
+		if *ids != "" || *contains != "" {
+			wanted := map[string]bool{}
+			for _, id := range strings.Split(*ids, ",") {
+				if id != "" {
+					wanted[id] = true
+				}
+			}
+			filter = func(msg types.Message) bool {
+				if len(wanted) > 0 && !wanted[aws.ToString(msg.MessageId)] {
+					return false
+				}
+				return strings.Contains(aws.ToString(msg.Body), *contains)
+			}
+		}
+		n, err := Redrive(ctx, svc, dlqURL, sourceURL, filter)
+		if err != nil {
+			return err
+		}
+		log.Printf("Redrove %d messages to %s\n", n, sourceURL)
+		return nil
+	}
+	return fmt.Errorf("unknown dlq action %q", action)
+}
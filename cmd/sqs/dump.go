@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DumpRecord is one line of a queue dump.
+type DumpRecord struct {
+	MessageID        string                   `json:"messageId"`
+	Body             string                   `json:"body"`
+	Attributes       map[string]DumpAttribute `json:"attributes,omitempty"`
+	SystemAttributes map[string]string        `json:"systemAttributes,omitempty"`
+}
+
+// DumpAttribute is a message attribute of a dump, binary values are base64 encoded.
+type DumpAttribute struct {
+	DataType    string `json:"dataType"`
+	StringValue string `json:"stringValue,omitempty"`
+	BinaryValue []byte `json:"binaryValue,omitempty"`
+}
+
+// NewDumpRecord converts a received message.
+func NewDumpRecord(msg types.Message) DumpRecord {
+	rec := DumpRecord{
+		MessageID:        aws.ToString(msg.MessageId),
+		Body:             aws.ToString(msg.Body),
+		SystemAttributes: msg.Attributes,
+	}
+	if len(msg.MessageAttributes) > 0 {
+		rec.Attributes = make(map[string]DumpAttribute, len(msg.MessageAttributes))
+		for name, attr := range msg.MessageAttributes {
+			rec.Attributes[name] = DumpAttribute{
+				DataType:    aws.ToString(attr.DataType),
+				StringValue: aws.ToString(attr.StringValue),
+				BinaryValue: attr.BinaryValue,
+			}
+		}
+	}
+	return rec
+}
+
+// Message converts the record to a message to send. Messages of FIFO queues keep their group,
+// and their original ID is used for deduplication so a load can be repeated safely.
+func (r DumpRecord) Message() OutgoingMessage {
+	msg := OutgoingMessage{Body: r.Body}
+	if len(r.Attributes) > 0 {
+		msg.Attributes = make(map[string]types.MessageAttributeValue, len(r.Attributes))
+		for name, attr := range r.Attributes {
+			v := types.MessageAttributeValue{DataType: aws.String(attr.DataType), BinaryValue: attr.BinaryValue}
+			if attr.BinaryValue == nil {
+				v.StringValue = aws.String(attr.StringValue)
+			}
+			msg.Attributes[name] = v
+		}
+	}
+	if group := r.SystemAttributes[string(types.MessageSystemAttributeNameMessageGroupId)]; group != "" {
+		msg.GroupID = group
+		msg.DedupID = r.MessageID
+	}
+	return msg
+}
+
+// PeekQueue receives up to limit messages and writes them to w as JSON Lines without consuming
+// them: every batch is received with a short visibility timeout and made visible again right
+// away. SQS returns random samples of a large queue, so the peek stops once three receives in a
+// row bring no new message. It returns the number of messages written.
+//
+// A peek is still a receive: it increments the ApproximateReceiveCount of every message it
+// sees, once per receive. With maxReceiveCount set to the queue's redrive limit, the peek stops
+// as soon as a message reaches that count, since receiving it again would move it to the
+// dead-letter queue. Such a message goes to the dead-letter queue on its next receive by a
+// consumer. Pass 0 for queues without a redrive policy.
+func PeekQueue(ctx context.Context, svc *sqs.Client, queueURL string, limit, maxReceiveCount int, w io.Writer) (int, error) {
+	var (
+		enc   = json.NewEncoder(w)
+		seen  = map[string]bool{}
+		stale int
+	)
+	for len(seen) < limit && stale < 3 {
+		out, err := svc.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(queueURL),
+			MaxNumberOfMessages:         maxBatchSize,
+			VisibilityTimeout:           5,
+			WaitTimeSeconds:             1,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			return len(seen), err
+		}
+		exhausted := 0
+		for _, msg := range out.Messages {
+			changeVisibility(ctx, svc, queueURL, msg, 0)
+			count, _ := strconv.Atoi(msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+			if maxReceiveCount > 0 && count >= maxReceiveCount {
+				log.Printf("Message %s has been received %d times, its next receive moves it to the dead-letter queue\n", aws.ToString(msg.MessageId), count)
+				exhausted++
+			}
+		}
+
+		stale++
+		for _, msg := range out.Messages {
+			id := aws.ToString(msg.MessageId)
+			if seen[id] || len(seen) == limit {
+				continue
+			}
+			seen[id] = true
+			stale = 0
+			if err := enc.Encode(NewDumpRecord(msg)); err != nil {
+				return len(seen), err
+			}
+		}
+		if exhausted > 0 {
+			log.Printf("Stopping the peek before it moves messages to the dead-letter queue\n")
+			break
+		}
+	}
+	return len(seen), nil
+}
+
+// ReadDump sends the records of a JSON Lines dump on the returned channel.
+func ReadDump(ctx context.Context, r io.Reader) (<-chan OutgoingMessage, <-chan error) {
+	msgs := make(chan OutgoingMessage, maxBatchSize)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(msgs)
+		defer close(errc)
+		scanner := bufio.NewScanner(r)
+		// A body of 256KB grows by up to a third when binary attributes are base64 encoded
+		scanner.Buffer(make([]byte, 64*1024), 2*maxBatchBytes)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var rec DumpRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				errc <- fmt.Errorf("line %d: %w", line, err)
+				return
+			}
+			select {
+			case msgs <- rec.Message():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+	return msgs, errc
+}
+
+// DumpCommand handles `dump -queue my-queue -out dump.jsonl` to peek at a queue, writing to
+// stdout without -out, and `dump load -queue my-queue -in dump.jsonl` to replay a dump. A queue
+// with a redrive policy is only dumped with -force, as peeking counts against maxReceiveCount.
+func DumpCommand(svc *sqs.Client, args []string) error {
+	load := len(args) > 0 && args[0] == "load"
+	if load {
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	out := fs.String("out", "-", "output file, - for stdout")
+	in := fs.String("in", "-", "dump to load, - for stdin (load only)")
+	limit := fs.Int("max", 1000, "messages to dump")
+	force := fs.Bool("force", false, "dump a queue with a redrive policy although peeking counts as a receive")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	if load {
+		r := os.Stdin
+		if *in != "-" {
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		msgs, errc := ReadDump(ctx, r)
+		producer := &BatchProducer{Client: svc, QueueURL: url}
+		stats, err := producer.Send(ctx, msgs)
+		if err != nil {
+			return err
+		}
+		if err := <-errc; err != nil {
+			return err
+		}
+		log.Printf("%s: %v\n", *queue, stats)
+		return nil
+	}
+
+	// Peeking counts as a receive, which brings messages closer to the dead-letter queue
+	policy, err := GetRedrivePolicy(ctx, svc, url)
+	if err != nil {
+		return err
+	}
+	maxReceives := 0
+	if policy != nil {
+		n, err := policy.MaxReceiveCount.Int64()
+		if err != nil {
+			return fmt.Errorf("maxReceiveCount of %s: %w", *queue, err)
+		}
+		maxReceives = int(n)
+		if !*force {
+			return fmt.Errorf("%s moves messages to %s after %d receives and every peek counts as a receive, add -force to dump it anyway",
+				*queue, policy.DeadLetterTargetArn, maxReceives)
+		}
+		log.Printf("Dumping %s increments the receive count of its messages, %d receives move a message to %s\n",
+			*queue, maxReceives, policy.DeadLetterTargetArn)
+	}
+
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := PeekQueue(ctx, svc, url, *limit, maxReceives, w)
+	if err != nil {
+		return err
+	}
+	log.Printf("Dumped %d messages of %s\n", n, *queue)
+	return nil
+}
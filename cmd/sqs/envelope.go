@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Message attributes of typed envelopes. Trace context uses the W3C Trace Context header names.
+const (
+	TypeAttribute        = "type"
+	ContentTypeAttribute = "contentType"
+	TraceParentAttribute = "traceparent"
+	TraceStateAttribute  = "tracestate"
+)
+
+// StringAttribute returns a String message attribute.
+func StringAttribute(v string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+}
+
+// NumberAttribute returns a Number message attribute of an integer or float. Floats are written
+// without an exponent, which SQS does not accept in numbers.
+func NumberAttribute[N int | int32 | int64 | uint | uint32 | uint64 | float32 | float64](v N) types.MessageAttributeValue {
+	s := fmt.Sprint(v)
+	switch f := any(v).(type) {
+	case float32:
+		s = strconv.FormatFloat(float64(f), 'f', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return types.MessageAttributeValue{DataType: aws.String("Number"), StringValue: aws.String(s)}
+}
+
+// BinaryAttribute returns a Binary message attribute.
+func BinaryAttribute(v []byte) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String("Binary"), BinaryValue: v}
+}
+
+// AttributeString returns the value of a String or Number attribute, "" when it is missing.
+func AttributeString(msg types.Message, name string) string {
+	return aws.ToString(msg.MessageAttributes[name].StringValue)
+}
+
+// AttributeNumber parses a Number attribute.
+func AttributeNumber(msg types.Message, name string) (float64, error) {
+	attr, ok := msg.MessageAttributes[name]
+	if !ok {
+		return 0, fmt.Errorf("attribute %s not set", name)
+	}
+	return strconv.ParseFloat(aws.ToString(attr.StringValue), 64)
+}
+
+// TraceContext is the W3C trace context carried from producer to consumer.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context carrying the trace context.
+func WithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// TraceFromContext returns the trace context of ctx, if any.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// NewTrace starts a new sampled trace.
+func NewTrace() TraceContext {
+	return TraceContext{TraceParent: "00-" + randomHex(16) + "-" + randomHex(8) + "-01"}
+}
+
+// TraceID returns the trace ID of the traceparent, "" when it is malformed.
+func (tc TraceContext) TraceID() string {
+	if len(tc.TraceParent) != 55 {
+		return ""
+	}
+	return tc.TraceParent[3:35]
+}
+
+// Child returns the trace context of a new span in the same trace.
+func (tc TraceContext) Child() TraceContext {
+	id := tc.TraceID()
+	if id == "" {
+		return NewTrace()
+	}
+	tc.TraceParent = tc.TraceParent[:36] + randomHex(8) + tc.TraceParent[52:]
+	return tc
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewEnvelope marshals v to a JSON body with the type attribute, the trace context of ctx and
+// the given custom attributes. groupID is the MessageGroupId on FIFO queues and must be empty
+// on standard queues. The result can be sent with SendEnvelope or a BatchProducer.
+func NewEnvelope(ctx context.Context, msgType string, v any, attrs map[string]types.MessageAttributeValue, groupID string) (OutgoingMessage, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return OutgoingMessage{}, fmt.Errorf("marshal %s: %w", msgType, err)
+	}
+
+	msg := OutgoingMessage{
+		Body:       string(body),
+		Attributes: make(map[string]types.MessageAttributeValue, len(attrs)+4),
+		GroupID:    groupID,
+	}
+	for k, a := range attrs {
+		msg.Attributes[k] = a
+	}
+	msg.Attributes[TypeAttribute] = StringAttribute(msgType)
+	msg.Attributes[ContentTypeAttribute] = StringAttribute("application/json")
+	if tc, ok := TraceFromContext(ctx); ok {
+		msg.Attributes[TraceParentAttribute] = StringAttribute(tc.TraceParent)
+		if tc.TraceState != "" {
+			msg.Attributes[TraceStateAttribute] = StringAttribute(tc.TraceState)
+		}
+	}
+	if len(msg.Attributes) > 10 {
+		return OutgoingMessage{}, fmt.Errorf("%s has %d message attributes, SQS allows 10", msgType, len(msg.Attributes))
+	}
+	return msg, nil
+}
+
+// SendEnvelope sends v as a typed envelope, in message group groupID on FIFO queues.
+func SendEnvelope(ctx context.Context, svc *sqs.Client, queueURL, msgType string, v any, attrs map[string]types.MessageAttributeValue, groupID string) (*sqs.SendMessageOutput, error) {
+	msg, err := NewEnvelope(ctx, msgType, v, attrs, groupID)
+	if err != nil {
+		return nil, err
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(msg.Body),
+		MessageAttributes: msg.Attributes,
+	}
+	if msg.GroupID != "" {
+		input.MessageGroupId = aws.String(msg.GroupID)
+	}
+	return svc.SendMessage(ctx, input)
+}
+
+// ErrUnknownType is returned by Router for messages without a registered handler.
+var ErrUnknownType = errors.New("no handler for message type")
+
+// Router dispatches envelopes to the handler registered for their type attribute. The handler
+// context carries a child of the producer's trace context. Router.Handle is a Handler, so it can
+// be passed to Consumer.Run.
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	// Fallback handles messages of unknown type; when nil they fail with ErrUnknownType
+	Fallback Handler
+}
+
+// Register sets the handler of a message type.
+func (r *Router) Register(msgType string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.handlers == nil {
+		r.handlers = map[string]Handler{}
+	}
+	r.handlers[msgType] = h
+}
+
+// HandleJSON registers a handler that receives the body decoded into T.
+func HandleJSON[T any](r *Router, msgType string, fn func(ctx context.Context, v T, msg types.Message) error) {
+	r.Register(msgType, func(ctx context.Context, msg types.Message) error {
+		var v T
+		if err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &v); err != nil {
+			return fmt.Errorf("decode %s: %w", msgType, err)
+		}
+		return fn(ctx, v, msg)
+	})
+}
+
+// Handle dispatches one message.
+func (r *Router) Handle(ctx context.Context, msg types.Message) error {
+	msgType := AttributeString(msg, TypeAttribute)
+	r.mu.RLock()
+	h, ok := r.handlers[msgType]
+	r.mu.RUnlock()
+	if !ok {
+		if r.Fallback == nil {
+			return fmt.Errorf("%w %q", ErrUnknownType, msgType)
+		}
+		h = r.Fallback
+	}
+
+	if parent := AttributeString(msg, TraceParentAttribute); parent != "" {
+		tc := TraceContext{TraceParent: parent, TraceState: AttributeString(msg, TraceStateAttribute)}
+		ctx = WithTrace(ctx, tc.Child())
+	}
+	return h(ctx, msg)
+}
+
+// OrderCreated and OrderCancelled are the sample message types of the typed command.
+type OrderCreated struct {
+	OrderID  string    `json:"orderId"`
+	Customer string    `json:"customer"`
+	Total    float64   `json:"total"`
+	Created  time.Time `json:"created"`
+}
+
+type OrderCancelled struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+}
+
+// TypedCommand handles `typed send|consume`.
+//
+//	typed send -queue my-queue -count 3
+//	typed send -queue my-queue.fifo -fifo
+//	typed consume -queue my-queue
+//
+// Queues named *.fifo are consumed with a FIFOConsumer, so a cancellation is handled after the
+// creation of its order.
+func TypedCommand(svc *sqs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: typed send|consume [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("typed "+action, flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	count := fs.Int("count", 3, "orders to create (send only)")
+	fifo := fs.Bool("fifo", false, "group the messages of an order, for FIFO queues with content-based deduplication (send only)")
+	fs.Parse(args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "send":
+		for i := 0; i < *count; i++ {
+			ctx := WithTrace(ctx, NewTrace())
+			order := OrderCreated{
+				OrderID:  fmt.Sprintf("order-%d", i),
+				Customer: "customer-1",
+				Total:    float64(i+1) * 9.99,
+				Created:  time.Now().UTC(),
+			}
+			attrs := map[string]types.MessageAttributeValue{
+				"priority": NumberAttribute(i % 3),
+				"checksum": BinaryAttribute([]byte(order.OrderID)),
+			}
+			// One group per order keeps the cancellation after the creation
+			group := ""
+			if *fifo {
+				group = order.OrderID
+			}
+			if _, err := SendEnvelope(ctx, svc, url, "OrderCreated", order, attrs, group); err != nil {
+				return err
+			}
+			if i%2 == 1 {
+				if _, err := SendEnvelope(ctx, svc, url, "OrderCancelled", OrderCancelled{OrderID: order.OrderID, Reason: "customer request"}, nil, group); err != nil {
+					return err
+				}
+			}
+		}
+		log.Printf("Sent %d orders to %s\n", *count, *queue)
+		return nil
+	case "consume":
+		router := &Router{
+			Fallback: func(ctx context.Context, msg types.Message) error {
+				log.Printf("  Untyped message %s: %s\n", aws.ToString(msg.MessageId), aws.ToString(msg.Body))
+				return nil
+			},
+		}
+		HandleJSON(router, "OrderCreated", func(ctx context.Context, order OrderCreated, msg types.Message) error {
+			tc, _ := TraceFromContext(ctx)
+			priority, _ := AttributeNumber(msg, "priority")
+			log.Printf("  Order %s created for %s: %.2f (priority %v, trace %s)\n", order.OrderID, order.Customer, order.Total, priority, tc.TraceID())
+			return nil
+		})
+		HandleJSON(router, "OrderCancelled", func(ctx context.Context, order OrderCancelled, msg types.Message) error {
+			tc, _ := TraceFromContext(ctx)
+			log.Printf("  Order %s cancelled: %s (trace %s)\n", order.OrderID, order.Reason, tc.TraceID())
+			return nil
+		})
+		if strings.HasSuffix(*queue, ".fifo") {
+			consumer := &FIFOConsumer{Consumer{Client: svc, QueueURL: url}}
+			return consumer.Run(ctx, router.Handle)
+		}
+		consumer := &Consumer{Client: svc, QueueURL: url}
+		return consumer.Run(ctx, router.Handle)
+	}
+	return fmt.Errorf("unknown typed action %q", action)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const testTraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func TestTraceContextChild(t *testing.T) {
+	parent := TraceContext{TraceParent: testTraceParent, TraceState: "vendor=value"}
+	child := parent.Child()
+	if child.TraceID() != parent.TraceID() {
+		t.Errorf("child trace ID = %q, want %q", child.TraceID(), parent.TraceID())
+	}
+	if len(child.TraceParent) != len(testTraceParent) || child.TraceParent[:36] != testTraceParent[:36] || child.TraceParent[52:] != testTraceParent[52:] {
+		t.Errorf("child traceparent %q does not keep version, trace ID and flags of %q", child.TraceParent, testTraceParent)
+	}
+	if child.TraceParent[36:52] == testTraceParent[36:52] {
+		t.Errorf("child traceparent %q keeps the parent span ID", child.TraceParent)
+	}
+	if child.TraceState != parent.TraceState {
+		t.Errorf("child tracestate = %q, want %q", child.TraceState, parent.TraceState)
+	}
+
+	for _, malformed := range []string{"", "00-abc-01"} {
+		child := TraceContext{TraceParent: malformed}.Child()
+		if child.TraceID() == "" {
+			t.Errorf("child of malformed %q = %q, want a new trace", malformed, child.TraceParent)
+		}
+	}
+}
+
+func TestNumberAttribute(t *testing.T) {
+	tests := []struct {
+		name string
+		got  types.MessageAttributeValue
+		want string
+	}{
+		{"int", NumberAttribute(42), "42"},
+		{"negative", NumberAttribute(int64(-7)), "-7"},
+		{"uint64", NumberAttribute(uint64(18446744073709551615)), "18446744073709551615"},
+		{"float", NumberAttribute(9.99), "9.99"},
+		{"large float", NumberAttribute(1e21), "1000000000000000000000"},
+		{"small float", NumberAttribute(1e-7), "0.0000001"},
+		{"float32", NumberAttribute(float32(0.1)), "0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aws.ToString(tt.got.StringValue); got != tt.want || aws.ToString(tt.got.DataType) != "Number" {
+				t.Errorf("NumberAttribute() = %s %q, want Number %q", aws.ToString(tt.got.DataType), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterHandle(t *testing.T) {
+	envelope := func(msgType, traceParent string) types.Message {
+		msg := types.Message{
+			Body:              aws.String(`{"orderId":"order-1","reason":"test"}`),
+			MessageAttributes: map[string]types.MessageAttributeValue{},
+		}
+		if msgType != "" {
+			msg.MessageAttributes[TypeAttribute] = StringAttribute(msgType)
+		}
+		if traceParent != "" {
+			msg.MessageAttributes[TraceParentAttribute] = StringAttribute(traceParent)
+		}
+		return msg
+	}
+
+	var (
+		got    string
+		trace  TraceContext
+		traced bool
+	)
+	record := func(name string) Handler {
+		return func(ctx context.Context, msg types.Message) error {
+			got = name
+			trace, traced = TraceFromContext(ctx)
+			return nil
+		}
+	}
+	router := &Router{}
+	router.Register("OrderCreated", record("created"))
+	HandleJSON(router, "OrderCancelled", func(ctx context.Context, order OrderCancelled, msg types.Message) error {
+		got = "cancelled " + order.OrderID
+		return nil
+	})
+
+	tests := []struct {
+		name     string
+		router   *Router
+		msg      types.Message
+		want     string
+		wantErr  error
+		wantSpan bool
+	}{
+		{"registered type", router, envelope("OrderCreated", ""), "created", nil, false},
+		{"json handler", router, envelope("OrderCancelled", ""), "cancelled order-1", nil, false},
+		{"trace context", router, envelope("OrderCreated", testTraceParent), "created", nil, true},
+		{"unknown type", router, envelope("OrderShipped", ""), "", ErrUnknownType, false},
+		{"no type", router, envelope("", ""), "", ErrUnknownType, false},
+		{"fallback", &Router{Fallback: record("fallback")}, envelope("OrderShipped", ""), "fallback", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, traced = "", false
+			err := tt.router.Handle(context.Background(), tt.msg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Handle() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("handled by %q, want %q", got, tt.want)
+			}
+			if traced != tt.wantSpan {
+				t.Fatalf("handler has trace context %t, want %t", traced, tt.wantSpan)
+			}
+			if traced && (trace.TraceID() != "0af7651916cd43dd8448eb211c80319c" || trace.TraceParent == testTraceParent) {
+				t.Errorf("handler trace context %q is not a child of %q", trace.TraceParent, testTraceParent)
+			}
+		})
+	}
+
+	t.Run("invalid json", func(t *testing.T) {
+		msg := envelope("OrderCancelled", "")
+		msg.Body = aws.String("not json")
+		if err := router.Handle(context.Background(), msg); err == nil {
+			t.Error("Handle() of an invalid body succeeded")
+		}
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Wire format of the Amazon SQS Extended Client Library for Java, so messages can be exchanged
+// with Java producers and consumers.
+const (
+	// ExtendedPayloadSizeAttribute holds the size of the original body of an offloaded message
+	ExtendedPayloadSizeAttribute = "ExtendedPayloadSize"
+	// legacyPayloadSizeAttribute is used by library versions before 2.0
+	legacyPayloadSizeAttribute = "SQSLargePayloadSize"
+	payloadPointerClass        = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	s3BucketNameMarker         = "-..s3BucketName..-"
+	s3KeyMarker                = "-..s3Key..-"
+)
+
+// maxMessageBytes is the SQS limit for one message, body plus attributes
+const maxMessageBytes = 256 * 1024
+
+// PayloadS3Pointer is the second element of the pointer message body:
+// ["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"...","s3Key":"..."}]
+type PayloadS3Pointer struct {
+	S3BucketName string `json:"s3BucketName"`
+	S3Key        string `json:"s3Key"`
+}
+
+// ExtendedClient stores message bodies larger than the SQS limit in S3 and sends a pointer
+// instead. Received pointers are resolved transparently, and the S3 object is deleted together
+// with the message.
+type ExtendedClient struct {
+	SQS    *sqs.Client
+	S3     *s3.Client
+	Bucket string
+	// Threshold in bytes above which bodies go to S3, default 256KB
+	Threshold int
+	// AlwaysThroughS3 offloads every body regardless of its size
+	AlwaysThroughS3 bool
+}
+
+// SendMessage sends the body directly or through S3 when it is too large.
+func (c *ExtendedClient) SendMessage(ctx context.Context, queueURL, body string, attrs map[string]types.MessageAttributeValue) (*sqs.SendMessageOutput, error) {
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: attrs,
+	}
+	if !c.AlwaysThroughS3 && (OutgoingMessage{Body: body, Attributes: attrs}).size() <= c.threshold() {
+		return c.SQS.SendMessage(ctx, input)
+	}
+
+	pointer, err := c.offload(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	input.MessageBody = aws.String(pointer)
+	input.MessageAttributes = make(map[string]types.MessageAttributeValue, len(attrs)+1)
+	for k, v := range attrs {
+		input.MessageAttributes[k] = v
+	}
+	input.MessageAttributes[ExtendedPayloadSizeAttribute] = types.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(strconv.Itoa(len(body))),
+	}
+	return c.SQS.SendMessage(ctx, input)
+}
+
+// PayloadError reports a received message whose S3 payload could not be resolved.
+type PayloadError struct {
+	MessageID     string
+	ReceiptHandle string
+	Err           error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("message %s: %v", e.MessageID, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// ReceiveMessage receives messages and replaces pointer bodies with the S3 object content.
+// The receipt handle of a resolved message carries the S3 location, the way the Java library
+// does it, so pass it to DeleteMessage of this client.
+//
+// A message whose payload cannot be resolved does not fail the others: it is left out of the
+// returned messages, stays in flight until its visibility timeout expires, and is reported as
+// a *PayloadError in the returned error, which joins one per such message.
+func (c *ExtendedClient) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput) ([]types.Message, error) {
+	params := *input
+	params.MessageAttributeNames = append(append([]string(nil), input.MessageAttributeNames...), ExtendedPayloadSizeAttribute, legacyPayloadSizeAttribute)
+	out, err := c.SQS.ReceiveMessage(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]types.Message, 0, len(out.Messages))
+	var errs []error
+	for _, msg := range out.Messages {
+		if isPointerMessage(msg) {
+			if err := c.resolve(ctx, &msg); err != nil {
+				errs = append(errs, &PayloadError{
+					MessageID:     aws.ToString(msg.MessageId),
+					ReceiptHandle: aws.ToString(msg.ReceiptHandle),
+					Err:           err,
+				})
+				continue
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, errors.Join(errs...)
+}
+
+// resolve replaces the pointer body of msg with the S3 object content.
+func (c *ExtendedClient) resolve(ctx context.Context, msg *types.Message) error {
+	pointer, err := parsePayloadPointer(aws.ToString(msg.Body))
+	if err != nil {
+		return err
+	}
+
+	obj, err := c.S3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(pointer.S3BucketName),
+		Key:    aws.String(pointer.S3Key),
+	})
+	if err != nil {
+		return fmt.Errorf("get payload s3://%s/%s: %w", pointer.S3BucketName, pointer.S3Key, err)
+	}
+	body, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		return fmt.Errorf("read payload s3://%s/%s: %w", pointer.S3BucketName, pointer.S3Key, err)
+	}
+
+	msg.Body = aws.String(string(body))
+	delete(msg.MessageAttributes, ExtendedPayloadSizeAttribute)
+	delete(msg.MessageAttributes, legacyPayloadSizeAttribute)
+	msg.ReceiptHandle = aws.String(extendedReceiptHandle(pointer, aws.ToString(msg.ReceiptHandle)))
+	return nil
+}
+
+// parsePayloadPointer decodes a pointer message body.
+func parsePayloadPointer(body string) (PayloadS3Pointer, error) {
+	var raw []json.RawMessage
+	var pointer PayloadS3Pointer
+	if err := json.Unmarshal([]byte(body), &raw); err != nil || len(raw) != 2 {
+		return pointer, errors.New("invalid S3 pointer body")
+	}
+	if err := json.Unmarshal(raw[1], &pointer); err != nil {
+		return pointer, fmt.Errorf("invalid S3 pointer: %w", err)
+	}
+	if pointer.S3BucketName == "" || pointer.S3Key == "" {
+		return pointer, errors.New("S3 pointer without bucket or key")
+	}
+	return pointer, nil
+}
+
+// extendedReceiptHandle prefixes the receipt handle with the S3 location of the payload.
+func extendedReceiptHandle(pointer PayloadS3Pointer, handle string) string {
+	return s3BucketNameMarker + pointer.S3BucketName + s3BucketNameMarker +
+		s3KeyMarker + pointer.S3Key + s3KeyMarker + handle
+}
+
+// DeleteMessage deletes the message and, for offloaded messages, its S3 object.
+func (c *ExtendedClient) DeleteMessage(ctx context.Context, queueURL, receiptHandle string) error {
+	pointer, handle := ParseExtendedReceiptHandle(receiptHandle)
+	if _, err := c.SQS.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: aws.String(handle),
+	}); err != nil {
+		return err
+	}
+	if pointer == nil {
+		return nil
+	}
+	_, err := c.S3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(pointer.S3BucketName),
+		Key:    aws.String(pointer.S3Key),
+	})
+	return err
+}
+
+// ParseExtendedReceiptHandle splits a receipt handle returned by ReceiveMessage into the S3
+// location, nil for messages that were not offloaded, and the SQS receipt handle.
+func ParseExtendedReceiptHandle(handle string) (*PayloadS3Pointer, string) {
+	if !strings.HasPrefix(handle, s3BucketNameMarker) {
+		return nil, handle
+	}
+	rest := strings.TrimPrefix(handle, s3BucketNameMarker)
+	bucket, rest, ok := strings.Cut(rest, s3BucketNameMarker)
+	if !ok || !strings.HasPrefix(rest, s3KeyMarker) {
+		return nil, handle
+	}
+	key, original, ok := strings.Cut(strings.TrimPrefix(rest, s3KeyMarker), s3KeyMarker)
+	if !ok {
+		return nil, handle
+	}
+	return &PayloadS3Pointer{S3BucketName: bucket, S3Key: key}, original
+}
+
+func (c *ExtendedClient) threshold() int {
+	if c.Threshold <= 0 {
+		return maxMessageBytes
+	}
+	return c.Threshold
+}
+
+// offload stores the body under a random key and returns the pointer message body.
+func (c *ExtendedClient) offload(ctx context.Context, body string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(id)
+
+	if _, err := c.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte(body)),
+	}); err != nil {
+		return "", fmt.Errorf("put payload s3://%s/%s: %w", c.Bucket, key, err)
+	}
+
+	pointer, err := json.Marshal([]any{payloadPointerClass, PayloadS3Pointer{S3BucketName: c.Bucket, S3Key: key}})
+	return string(pointer), err
+}
+
+// EnsureBucket creates the payload bucket if it does not exist.
+func (c *ExtendedClient) EnsureBucket(ctx context.Context) error {
+	_, err := c.S3.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(c.Bucket)})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		_, err = c.S3.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(c.Bucket)})
+	}
+	return err
+}
+
+func isPointerMessage(msg types.Message) bool {
+	_, ok := msg.MessageAttributes[ExtendedPayloadSizeAttribute]
+	_, legacy := msg.MessageAttributes[legacyPayloadSizeAttribute]
+	return ok || legacy
+}
+
+// LargeCommand handles `large send|receive`.
+//
+//	large send -queue my-queue -bucket my-bucket -size 300000
+//	large receive -queue my-queue -bucket my-bucket
+func LargeCommand(provider aws.Config, svc *sqs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: large send|receive [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("large "+action, flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	bucket := fs.String("bucket", "my-bucket", "bucket for offloaded payloads")
+	size := fs.Int("size", 300*1024, "body size in bytes (send only)")
+	always := fs.Bool("always-s3", false, "offload every body (send only)")
+	fs.Parse(args[1:])
+
+	ctx := context.TODO()
+	client := &ExtendedClient{
+		SQS:             svc,
+		S3:              s3.NewFromConfig(provider, func(o *s3.Options) { o.UsePathStyle = true }),
+		Bucket:          *bucket,
+		AlwaysThroughS3: *always,
+	}
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "send":
+		if err := client.EnsureBucket(ctx); err != nil {
+			return err
+		}
+		out, err := client.SendMessage(ctx, url, strings.Repeat("x", *size), nil)
+		if err != nil {
+			return err
+		}
+		log.Printf("Sent message %s with %d bytes\n", aws.ToString(out.MessageId), *size)
+		return nil
+	case "receive":
+		msgs, recvErr := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(url),
+			MaxNumberOfMessages:   maxBatchSize,
+			WaitTimeSeconds:       5,
+			MessageAttributeNames: []string{"All"},
+		})
+		// Messages with an unresolved payload are reported after the others are handled
+		var payloadErr *PayloadError
+		if recvErr != nil && !errors.As(recvErr, &payloadErr) {
+			return recvErr
+		}
+		for _, msg := range msgs {
+			pointer, _ := ParseExtendedReceiptHandle(aws.ToString(msg.ReceiptHandle))
+			from := "SQS"
+			if pointer != nil {
+				from = fmt.Sprintf("s3://%s/%s", pointer.S3BucketName, pointer.S3Key)
+			}
+			log.Printf("  Message ID: %s, %d bytes from %s, %d attributes\n", aws.ToString(msg.MessageId), len(aws.ToString(msg.Body)), from, len(msg.MessageAttributes))
+			if err := client.DeleteMessage(ctx, url, aws.ToString(msg.ReceiptHandle)); err != nil {
+				return err
+			}
+		}
+		return recvErr
+	}
+	return fmt.Errorf("unknown large action %q", action)
+}
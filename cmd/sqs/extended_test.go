@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func TestParsePayloadPointer(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    PayloadS3Pointer
+		wantErr bool
+	}{
+		{
+			name: "java library body",
+			body: `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"my-bucket","s3Key":"abc"}]`,
+			want: PayloadS3Pointer{S3BucketName: "my-bucket", S3Key: "abc"},
+		},
+		{name: "not json", body: "hello", wantErr: true},
+		{name: "one element", body: `["software.amazon.payloadoffloading.PayloadS3Pointer"]`, wantErr: true},
+		{name: "pointer not an object", body: `["software.amazon.payloadoffloading.PayloadS3Pointer","s3://b/k"]`, wantErr: true},
+		{name: "no key", body: `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"my-bucket"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePayloadPointer(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePayloadPointer() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePayloadPointer() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExtendedReceiptHandle(t *testing.T) {
+	pointer := PayloadS3Pointer{S3BucketName: "my-bucket", S3Key: "a/b-c"}
+	tests := []struct {
+		name        string
+		handle      string
+		wantPointer *PayloadS3Pointer
+		wantHandle  string
+	}{
+		{"offloaded", extendedReceiptHandle(pointer, "AQEB+handle=="), &pointer, "AQEB+handle=="},
+		{"java library handle", "-..s3BucketName..-my-bucket-..s3BucketName..--..s3Key..-a/b-c-..s3Key..-AQEB+handle==", &pointer, "AQEB+handle=="},
+		{"plain", "AQEB+handle==", nil, "AQEB+handle=="},
+		{"no key marker", "-..s3BucketName..-my-bucket-..s3BucketName..-AQEB", nil, "-..s3BucketName..-my-bucket-..s3BucketName..-AQEB"},
+		{"unterminated key", "-..s3BucketName..-my-bucket-..s3BucketName..--..s3Key..-abc", nil, "-..s3BucketName..-my-bucket-..s3BucketName..--..s3Key..-abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPointer, gotHandle := ParseExtendedReceiptHandle(tt.handle)
+			if gotHandle != tt.wantHandle {
+				t.Errorf("handle = %q, want %q", gotHandle, tt.wantHandle)
+			}
+			switch {
+			case gotPointer == nil && tt.wantPointer != nil:
+				t.Errorf("pointer = nil, want %+v", *tt.wantPointer)
+			case gotPointer != nil && tt.wantPointer == nil:
+				t.Errorf("pointer = %+v, want nil", *gotPointer)
+			case gotPointer != nil && *gotPointer != *tt.wantPointer:
+				t.Errorf("pointer = %+v, want %+v", *gotPointer, *tt.wantPointer)
+			}
+		})
+	}
+}
+
+func TestIsPointerMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs map[string]types.MessageAttributeValue
+		want  bool
+	}{
+		{"plain", map[string]types.MessageAttributeValue{"type": StringAttribute("x")}, false},
+		{"no attributes", nil, false},
+		{"size attribute", map[string]types.MessageAttributeValue{ExtendedPayloadSizeAttribute: NumberAttribute(300000)}, true},
+		{"legacy size attribute", map[string]types.MessageAttributeValue{legacyPayloadSizeAttribute: NumberAttribute(300000)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPointerMessage(types.Message{MessageAttributes: tt.attrs}); got != tt.want {
+				t.Errorf("isPointerMessage() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
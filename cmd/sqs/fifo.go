@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// CreateFIFOQueue creates a FIFO queue. The name must end with ".fifo". With content-based
+// deduplication a message without a MessageDeduplicationId is deduplicated by a hash of its body.
+func CreateFIFOQueue(ctx context.Context, svc *sqs.Client, name string, contentDedup bool) (string, error) {
+	if !strings.HasSuffix(name, ".fifo") {
+		return "", fmt.Errorf("FIFO queue name %q must end with .fifo", name)
+	}
+	out, err := svc.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String(name),
+		Attributes: map[string]string{
+			string(types.QueueAttributeNameFifoQueue):                 "true",
+			string(types.QueueAttributeNameContentBasedDeduplication): strconv.FormatBool(contentDedup),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("create queue %s: %w", name, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+// SendFIFO sends a message to a FIFO queue. dedupID may be empty when the queue uses
+// content-based deduplication.
+func SendFIFO(ctx context.Context, svc *sqs.Client, queueURL, body, groupID, dedupID string) (*sqs.SendMessageOutput, error) {
+	input := &sqs.SendMessageInput{
+		QueueUrl:       aws.String(queueURL),
+		MessageBody:    aws.String(body),
+		MessageGroupId: aws.String(groupID),
+	}
+	if dedupID != "" {
+		input.MessageDeduplicationId = aws.String(dedupID)
+	}
+	return svc.SendMessage(ctx, input)
+}
+
+// MessageGroupID returns the MessageGroupId system attribute of a received FIFO message.
+func MessageGroupID(msg types.Message) string {
+	return msg.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+}
+
+// FIFOConsumer processes the messages of each message group one at a time and in order, while
+// different groups run concurrently on up to Workers goroutines. When a handler fails, the rest
+// of its group in the batch is released so SQS redelivers the group in order.
+type FIFOConsumer struct {
+	Consumer
+}
+
+// Run consumes until ctx is cancelled. The batch in progress is completed before returning.
+func (c *FIFOConsumer) Run(ctx context.Context, handler Handler) error {
+	c.setDefaults()
+
+	for ctx.Err() == nil {
+		msgs, err := c.receive(ctx, c.MaxMessages)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to receive messages: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		c.processBatch(ctx, msgs, handler)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil
+	}
+	return ctx.Err()
+}
+
+func (c *FIFOConsumer) processBatch(ctx context.Context, msgs []types.Message, handler Handler) {
+	// Messages of a group arrive in order, keep that order per group
+	var (
+		groups = map[string][]types.Message{}
+		order  []string
+	)
+	for _, msg := range msgs {
+		id := MessageGroupID(msg)
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], msg)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, c.Workers)
+	)
+	for _, id := range order {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(group []types.Message) {
+			defer func() { <-sem; wg.Done() }()
+			c.processGroup(ctx, group, handler)
+		}(groups[id])
+	}
+	wg.Wait()
+}
+
+func (c *FIFOConsumer) processGroup(ctx context.Context, group []types.Message, handler Handler) {
+	handlerCtx := context.WithoutCancel(ctx)
+	var done []types.Message
+	defer func() {
+		DeleteMessages(handlerCtx, c.Client, c.QueueURL, done)
+	}()
+
+	for i, msg := range group {
+		stop := make(chan struct{})
+		go c.heartbeat(handlerCtx, msg, stop)
+		err := handler(handlerCtx, msg)
+		close(stop)
+
+		if err != nil {
+			log.Printf("Handler failed for message %s of group %s: %v", aws.ToString(msg.MessageId), MessageGroupID(msg), err)
+			for _, rest := range group[i+1:] {
+				c.release(rest)
+			}
+			return
+		}
+		done = append(done, msg)
+	}
+}
+
+// FIFOCommand handles `fifo create|send|consume`.
+//
+//	fifo create -queue orders.fifo -content-dedup
+//	fifo send -queue orders.fifo -groups 3 -count 5
+//	fifo consume -queue orders.fifo -workers 3
+func FIFOCommand(svc *sqs.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fifo create|send|consume [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("fifo "+action, flag.ExitOnError)
+	queue := fs.String("queue", "my-queue.fifo", "FIFO queue name")
+	contentDedup := fs.Bool("content-dedup", true, "enable content-based deduplication (create only)")
+	groups := fs.Int("groups", 3, "number of message groups (send only)")
+	count := fs.Int("count", 5, "messages per group (send only)")
+	workers := fs.Int("workers", 4, "concurrent groups (consume only)")
+	fs.Parse(args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if action == "create" {
+		url, err := CreateFIFOQueue(ctx, svc, *queue, *contentDedup)
+		if err != nil {
+			return err
+		}
+		log.Printf("Queue URL: %s\n", url)
+		return nil
+	}
+
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "send":
+		for i := 0; i < *count; i++ {
+			for g := 0; g < *groups; g++ {
+				group := fmt.Sprintf("group-%d", g)
+				body := fmt.Sprintf("%s message %d", group, i)
+				dedup := fmt.Sprintf("%s-%d-%d", group, i, time.Now().UnixNano())
+				if _, err := SendFIFO(ctx, svc, url, body, group, dedup); err != nil {
+					return err
+				}
+			}
+		}
+		log.Printf("Sent %d messages to %s\n", *count**groups, *queue)
+		return nil
+	case "consume":
+		consumer := &FIFOConsumer{Consumer{Client: svc, QueueURL: url, Workers: *workers}}
+		return consumer.Run(ctx, func(ctx context.Context, msg types.Message) error {
+			log.Printf("  [%s] %s\n", MessageGroupID(msg), aws.ToString(msg.Body))
+			return nil
+		})
+	}
+	return fmt.Errorf("unknown fifo action %q", action)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 
@@ -48,12 +49,45 @@ func main() {
 	// Create SQS service client
 	svc := sqs.NewFromConfig(provider)
 
+	// Run a sub-command when one is given, e.g. `go run ./cmd/sqs consume -queue my-queue`
+	if len(os.Args) > 1 {
+		RunCommand(provider, svc, os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Create a new queue
 	CreateQueue(svc)
 	// List queues
 	ListQueues(svc)
 }
 
+func RunCommand(provider aws.Config, svc *sqs.Client, name string, args []string) {
+	var err error
+	switch name {
+	case "consume":
+		err = ConsumeCommand(svc, args)
+	case "fifo":
+		err = FIFOCommand(svc, args)
+	case "dlq":
+		err = DLQCommand(svc, args)
+	case "send":
+		err = SendCommand(svc, args)
+	case "large":
+		err = LargeCommand(provider, svc, args)
+	case "typed":
+		err = TypedCommand(svc, args)
+	case "queue":
+		err = QueueCommand(svc, args)
+	case "dump":
+		err = DumpCommand(svc, args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
+
 func CreateQueue(svc *sqs.Client) {
 	// Create a new queue
 	result, err := svc.CreateQueue(context.TODO(), &sqs.CreateQueueInput{
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maxBatchBytes is the SendMessageBatch payload limit, summed over all entries
+const maxBatchBytes = 256 * 1024
+
+// OutgoingMessage is a message to send with BatchProducer.
+type OutgoingMessage struct {
+	Body       string
+	Attributes map[string]types.MessageAttributeValue
+	GroupID    string // FIFO queues only
+	DedupID    string // FIFO queues without content-based deduplication only
+}
+
+// size is the number of bytes the message counts against the batch limit: the body plus the
+// name, type and value of every attribute.
+func (m OutgoingMessage) size() int {
+	n := len(m.Body)
+	for name, attr := range m.Attributes {
+		n += len(name) + len(aws.ToString(attr.DataType)) + len(aws.ToString(attr.StringValue)) + len(attr.BinaryValue)
+	}
+	return n
+}
+
+// splitBatches splits msgs into consecutive batches of at most 10 entries and 256KB and
+// returns the end index of every batch. A message over the limit gets a batch of its own.
+func splitBatches(msgs []OutgoingMessage) []int {
+	var (
+		ends  []int
+		start int
+		size  int
+	)
+	for i, msg := range msgs {
+		n := msg.size()
+		if i > start && (i-start == maxBatchSize || size+n > maxBatchBytes) {
+			ends = append(ends, i)
+			start, size = i, 0
+		}
+		size += n
+	}
+	if len(msgs) > start {
+		ends = append(ends, len(msgs))
+	}
+	return ends
+}
+
+// ProducerStats summarizes a BatchProducer run.
+type ProducerStats struct {
+	Sent     int
+	Failed   int
+	Batches  int
+	Retries  int
+	Bytes    int
+	Duration time.Duration
+}
+
+// PerSecond is the number of messages sent per second.
+func (s ProducerStats) PerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Sent) / s.Duration.Seconds()
+}
+
+func (s ProducerStats) String() string {
+	return fmt.Sprintf("sent %d, failed %d in %d batches (%d retries), %d bytes in %s, %.1f msg/s",
+		s.Sent, s.Failed, s.Batches, s.Retries, s.Bytes, s.Duration.Round(time.Millisecond), s.PerSecond())
+}
+
+// BatchSender is the SQS call BatchProducer makes, implemented by *sqs.Client.
+type BatchSender interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// BatchProducer groups messages into SendMessageBatch calls of at most 10 entries and 256KB,
+// and resends only the entries that failed, in their original order. On a FIFO queue a failed
+// entry blocks its message group: until it is sent, retries carry only the first pending entry
+// of the group and the later entries of the group are held back.
+type BatchProducer struct {
+	Client   BatchSender
+	QueueURL string
+	// MaxRetries for failed entries, default 3. Entries failing with SenderFault are not retried.
+	MaxRetries int
+	// RetryDelay is the wait before the first retry, doubled for every further one, default 200ms
+	RetryDelay time.Duration
+}
+
+// Send reads messages until the channel is closed or ctx is cancelled.
+func (p *BatchProducer) Send(ctx context.Context, msgs <-chan OutgoingMessage) (stats ProducerStats, err error) {
+	var (
+		batch []OutgoingMessage
+		size  int
+		start = time.Now()
+	)
+	defer func() { stats.Duration = time.Since(start) }()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := p.sendBatch(ctx, batch, &stats)
+		batch, size = nil, 0
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return stats, flush()
+			}
+			n := msg.size()
+			if n > maxBatchBytes {
+				log.Printf("Skipping message of %d bytes, the limit is %d", n, maxBatchBytes)
+				stats.Failed++
+				continue
+			}
+			if len(batch) == maxBatchSize || size+n > maxBatchBytes {
+				if err := flush(); err != nil {
+					return stats, err
+				}
+			}
+			batch = append(batch, msg)
+			size += n
+		}
+	}
+}
+
+func (p *BatchProducer) sendBatch(ctx context.Context, batch []OutgoingMessage, stats *ProducerStats) error {
+	maxRetries := p.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	retryDelay := p.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = 200 * time.Millisecond
+	}
+
+	// Entries keep their order, FIFO queues store a batch in entry order
+	ids := make([]string, len(batch))
+	pending := make(map[string]OutgoingMessage, len(batch))
+	for i, msg := range batch {
+		ids[i] = strconv.Itoa(i)
+		pending[ids[i]] = msg
+	}
+	fifo := strings.HasSuffix(p.QueueURL, ".fifo")
+	// blocked holds the FIFO message groups with a failed entry that is not sent yet
+	blocked := map[string]bool{}
+
+	// retry is the number of calls so far that had entries to retry, failed is set when the
+	// last call had one. Entries that were only held back are sent right away.
+	for retry, failed := 0, false; len(pending) > 0; {
+		if failed {
+			retry++
+			if retry > maxRetries {
+				stats.Failed += len(pending)
+				return nil
+			}
+			stats.Retries++
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay << (retry - 1)):
+			}
+		}
+
+		entries := make([]types.SendMessageBatchRequestEntry, 0, len(pending))
+		held := map[string]bool{}
+		for _, id := range ids {
+			msg, ok := pending[id]
+			if !ok {
+				continue
+			}
+			if blocked[msg.GroupID] {
+				if held[msg.GroupID] {
+					continue
+				}
+				held[msg.GroupID] = true
+			}
+			entry := types.SendMessageBatchRequestEntry{
+				Id:                aws.String(id),
+				MessageBody:       aws.String(msg.Body),
+				MessageAttributes: msg.Attributes,
+			}
+			if msg.GroupID != "" {
+				entry.MessageGroupId = aws.String(msg.GroupID)
+			}
+			if msg.DedupID != "" {
+				entry.MessageDeduplicationId = aws.String(msg.DedupID)
+			}
+			entries = append(entries, entry)
+		}
+
+		stats.Batches++
+		out, err := p.Client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(p.QueueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return fmt.Errorf("send message batch: %w", err)
+		}
+
+		for _, s := range out.Successful {
+			id := aws.ToString(s.Id)
+			stats.Sent++
+			stats.Bytes += pending[id].size()
+			delete(blocked, pending[id].GroupID)
+			delete(pending, id)
+		}
+		failed = false
+		for _, f := range out.Failed {
+			id := aws.ToString(f.Id)
+			if f.SenderFault {
+				log.Printf("Message rejected: %s %s", aws.ToString(f.Code), aws.ToString(f.Message))
+				stats.Failed++
+				delete(pending, id)
+				continue
+			}
+			failed = true
+			if fifo {
+				blocked[pending[id].GroupID] = true
+			}
+		}
+	}
+	return nil
+}
+
+// ReadLines sends every non-empty line of r as a message body on the returned channel. The
+// reading goroutine stops when ctx is cancelled, so a consumer that stops reading before the
+// channel is closed must cancel ctx.
+func ReadLines(ctx context.Context, r io.Reader) (<-chan OutgoingMessage, <-chan error) {
+	msgs := make(chan OutgoingMessage, maxBatchSize)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(msgs)
+		defer close(errc)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxBatchBytes+1)
+		for scanner.Scan() {
+			if scanner.Text() == "" {
+				continue
+			}
+			select {
+			case msgs <- OutgoingMessage{Body: scanner.Text()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+	return msgs, errc
+}
+
+// SendCommand handles `send -queue my-queue -file messages.txt`, one message per line, or
+// `send -queue my-queue -count 1000` to generate messages.
+func SendCommand(svc *sqs.Client, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	queue := fs.String("queue", "my-queue", "queue name")
+	file := fs.String("file", "", "file with one message body per line, - for stdin")
+	count := fs.Int("count", 100, "number of generated messages when no file is given")
+	group := fs.String("group", "", "MessageGroupId for FIFO queues")
+	fs.Parse(args)
+
+	// Cancelled on return so the goroutines feeding msgs stop if Send gives up early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, err := GetQueueURL(ctx, svc, *queue)
+	if err != nil {
+		return err
+	}
+
+	var (
+		msgs <-chan OutgoingMessage
+		errc <-chan error
+	)
+	switch *file {
+	case "":
+		gen := make(chan OutgoingMessage)
+		go func() {
+			defer close(gen)
+			for i := 0; i < *count; i++ {
+				select {
+				case gen <- OutgoingMessage{Body: fmt.Sprintf("Hello World! #%d", i)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		msgs = gen
+	case "-":
+		msgs, errc = ReadLines(ctx, os.Stdin)
+	default:
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		msgs, errc = ReadLines(ctx, f)
+	}
+
+	if *group != "" {
+		grouped := make(chan OutgoingMessage)
+		go func(in <-chan OutgoingMessage) {
+			defer close(grouped)
+			for msg := range in {
+				msg.GroupID = *group
+				select {
+				case grouped <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(msgs)
+		msgs = grouped
+	}
+
+	producer := &BatchProducer{Client: svc, QueueURL: url}
+	stats, err := producer.Send(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	if errc != nil {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	log.Printf("%s: %v\n", *queue, stats)
+	return nil
+}
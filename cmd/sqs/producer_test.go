@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func testMessages(sizes ...int) []OutgoingMessage {
+	msgs := make([]OutgoingMessage, len(sizes))
+	for i, n := range sizes {
+		msgs[i] = OutgoingMessage{Body: strings.Repeat("x", n)}
+	}
+	return msgs
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []OutgoingMessage
+		want []int
+	}{
+		{"empty", nil, nil},
+		{"one batch", testMessages(1, 2, 3), []int{3}},
+		{"entry count", testMessages(1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1), []int{10, 12}},
+		{"bytes", testMessages(100*1024, 100*1024, 100*1024), []int{2, 3}},
+		{"exactly the limit", testMessages(128*1024, 128*1024, 1), []int{2, 3}},
+		{"oversized message", testMessages(1, maxBatchBytes+1, 1), []int{1, 2, 3}},
+		{"attributes count", []OutgoingMessage{
+			{Body: strings.Repeat("x", maxBatchBytes-10)},
+			{Body: "x", Attributes: map[string]types.MessageAttributeValue{"name": StringAttribute("value")}},
+		}, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitBatches(tt.msgs); !slices.Equal(got, tt.want) {
+				t.Errorf("splitBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeBatchSender records the bodies of every SendMessageBatch call and fails the entries
+// listed for the call.
+type fakeBatchSender struct {
+	fail  [][]string // bodies failing in each call, retryable
+	fault []string   // bodies rejected with SenderFault in every call
+	calls [][]string
+}
+
+func (f *fakeBatchSender) SendMessageBatch(ctx context.Context, in *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	call := len(f.calls)
+	out := &sqs.SendMessageBatchOutput{}
+	var bodies []string
+	for _, e := range in.Entries {
+		body := aws.ToString(e.MessageBody)
+		bodies = append(bodies, body)
+		switch {
+		case slices.Contains(f.fault, body):
+			out.Failed = append(out.Failed, types.BatchResultErrorEntry{Id: e.Id, SenderFault: true, Code: aws.String("InvalidMessageContents")})
+		case call < len(f.fail) && slices.Contains(f.fail[call], body):
+			out.Failed = append(out.Failed, types.BatchResultErrorEntry{Id: e.Id, Code: aws.String("InternalError")})
+		default:
+			out.Successful = append(out.Successful, types.SendMessageBatchResultEntry{Id: e.Id})
+		}
+	}
+	f.calls = append(f.calls, bodies)
+	return out, nil
+}
+
+func TestSendBatch(t *testing.T) {
+	plain := []OutgoingMessage{{Body: "a"}, {Body: "b"}, {Body: "c"}, {Body: "d"}}
+	grouped := []OutgoingMessage{
+		{Body: "a", GroupID: "g1"},
+		{Body: "b", GroupID: "g1"},
+		{Body: "c", GroupID: "g2"},
+		{Body: "d", GroupID: "g1"},
+	}
+	tests := []struct {
+		name   string
+		queue  string
+		batch  []OutgoingMessage
+		sender fakeBatchSender
+		// want is the bodies of every call
+		want                  [][]string
+		sent, failed, retries int
+	}{
+		{
+			name:  "all sent",
+			queue: "my-queue",
+			batch: plain,
+			want:  [][]string{{"a", "b", "c", "d"}},
+			sent:  4,
+		},
+		{
+			name:   "failed entries are retried in order",
+			queue:  "my-queue",
+			batch:  plain,
+			sender: fakeBatchSender{fail: [][]string{{"b", "d"}, {"d"}}},
+			want:   [][]string{{"a", "b", "c", "d"}, {"b", "d"}, {"d"}},
+			sent:   4, retries: 2,
+		},
+		{
+			name:   "sender fault is not retried",
+			queue:  "my-queue",
+			batch:  plain,
+			sender: fakeBatchSender{fault: []string{"b"}},
+			want:   [][]string{{"a", "b", "c", "d"}},
+			sent:   3, failed: 1,
+		},
+		{
+			name:   "gives up after max retries",
+			queue:  "my-queue",
+			batch:  plain,
+			sender: fakeBatchSender{fail: [][]string{{"c"}, {"c"}, {"c"}, {"c"}}},
+			want:   [][]string{{"a", "b", "c", "d"}, {"c"}, {"c"}, {"c"}},
+			sent:   3, failed: 1, retries: 3,
+		},
+		{
+			name:   "standard queue does not hold back groups",
+			queue:  "my-queue",
+			batch:  grouped,
+			sender: fakeBatchSender{fail: [][]string{{"a"}}},
+			want:   [][]string{{"a", "b", "c", "d"}, {"a"}},
+			sent:   4, retries: 1,
+		},
+		{
+			name:   "blocked group sends only its first entry",
+			queue:  "my-queue.fifo",
+			batch:  grouped,
+			sender: fakeBatchSender{fail: [][]string{{"a", "b", "d"}}},
+			want:   [][]string{{"a", "b", "c", "d"}, {"a"}, {"b", "d"}},
+			sent:   4, retries: 1,
+		},
+		{
+			name:   "group stays blocked until its first entry is sent",
+			queue:  "my-queue.fifo",
+			batch:  grouped,
+			sender: fakeBatchSender{fail: [][]string{{"b", "c", "d"}, {"b", "c"}, {}, {"d"}}},
+			want:   [][]string{{"a", "b", "c", "d"}, {"b", "c"}, {"b", "c"}, {"d"}, {"d"}},
+			sent:   4, retries: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &BatchProducer{Client: &tt.sender, QueueURL: "https://sqs.example.com/000000000000/" + tt.queue, RetryDelay: time.Microsecond}
+			var stats ProducerStats
+			if err := p.sendBatch(context.Background(), tt.batch, &stats); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.sender.calls, tt.want) {
+				t.Errorf("calls = %q, want %q", tt.sender.calls, tt.want)
+			}
+			if stats.Sent != tt.sent || stats.Failed != tt.failed || stats.Retries != tt.retries {
+				t.Errorf("sent %d, failed %d, retries %d, want %d, %d, %d", stats.Sent, stats.Failed, stats.Retries, tt.sent, tt.failed, tt.retries)
+			}
+		})
+	}
+}